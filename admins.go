@@ -0,0 +1,232 @@
+package main
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+)
+
+const adminsFile = "admins.json"
+
+// AdminAccount is an admin who can sign in to manage exams.
+type AdminAccount struct {
+    Username     string
+    PasswordHash string
+    Role         Role
+}
+
+// Admin accounts keyed by username
+var adminAccounts = make(map[string]AdminAccount)
+
+// loadAdmins reads the persisted admin accounts, creating the default
+// admin/admin123 account on first run.
+func loadAdmins() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    var accounts []AdminAccount
+    err := loadJSON(adminsFile, &accounts)
+    if err == nil && len(accounts) > 0 {
+        for _, a := range accounts {
+            adminAccounts[a.Username] = a
+        }
+        return
+    }
+    if err != nil && !os.IsNotExist(err) {
+        log.Fatalf("loading %s: %v", adminsFile, err)
+    }
+
+    adminAccounts["admin"] = AdminAccount{Username: "admin", PasswordHash: hashPassword("admin123"), Role: RoleAdmin}
+    if err := saveAdmins(); err != nil {
+        log.Printf("saving %s: %v", adminsFile, err)
+    }
+}
+
+// saveAdmins persists the admin accounts. Caller must hold mu.
+func saveAdmins() error {
+    accounts := make([]AdminAccount, 0, len(adminAccounts))
+    for _, a := range adminAccounts {
+        accounts = append(accounts, a)
+    }
+    sort.Slice(accounts, func(i, j int) bool { return accounts[i].Username < accounts[j].Username })
+    return saveJSON(adminsFile, accounts)
+}
+
+// authenticateAdmin reports whether the credentials match an admin account.
+func authenticateAdmin(username, password string) bool {
+    mu.Lock()
+    account, ok := adminAccounts[username]
+    mu.Unlock()
+    return ok && checkPassword(account.PasswordHash, password)
+}
+
+// adminCount returns how many accounts hold the admin role. Caller must hold mu.
+func adminCount() int {
+    count := 0
+    for _, a := range adminAccounts {
+        if accountRole(a) == RoleAdmin {
+            count++
+        }
+    }
+    return count
+}
+
+// API endpoint to list staff accounts and their roles
+func listAdminsHandler(w http.ResponseWriter, r *http.Request) {
+    type adminInfo struct {
+        Username string
+        Role     Role
+    }
+
+    mu.Lock()
+    list := make([]adminInfo, 0, len(adminAccounts))
+    for _, a := range adminAccounts {
+        list = append(list, adminInfo{Username: a.Username, Role: accountRole(a)})
+    }
+    mu.Unlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
+
+// Add admin handler
+func addAdminHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := strings.TrimSpace(r.FormValue("username"))
+    password := r.FormValue("password")
+    role := Role(r.FormValue("role"))
+    if role == "" {
+        role = RoleAdmin
+    }
+    if username == "" || password == "" {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Username and password are required"})
+        return
+    }
+    if problems := passwordProblems(cfg, password); len(problems) > 0 {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Password " + strings.Join(problems, "; ")})
+        return
+    }
+    if !validRole(role) {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Unknown role"})
+        return
+    }
+
+    hash := hashPassword(password)
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if _, exists := adminAccounts[username]; exists {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Username already exists"})
+        return
+    }
+
+    adminAccounts[username] = AdminAccount{Username: username, PasswordHash: hash, Role: role}
+    if err := saveAdmins(); err != nil {
+        delete(adminAccounts, username)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving admin"})
+        return
+    }
+    recordAudit(admin, "add-admin", username+" as "+string(role))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Admin added successfully"})
+}
+
+// Delete admin handler; the last remaining admin cannot be removed
+func deleteAdminHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    account, exists := adminAccounts[username]
+    if !exists {
+        http.Error(w, "Admin not found", http.StatusNotFound)
+        return
+    }
+    if accountRole(account) == RoleAdmin && adminCount() == 1 {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Cannot delete the last admin"})
+        return
+    }
+
+    delete(adminAccounts, username)
+    if err := saveAdmins(); err != nil {
+        adminAccounts[username] = account
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving admins"})
+        return
+    }
+    for token, name := range adminSessions {
+        if name == username {
+            delete(adminSessions, token)
+        }
+    }
+    recordAudit(admin, "delete-admin", username)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Admin deleted successfully"})
+}
+
+// API endpoint to change a staff account's role
+func setAdminRoleHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+    role := Role(r.FormValue("role"))
+    if !validRole(role) {
+        http.Error(w, "Unknown role", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    account, exists := adminAccounts[username]
+    if !exists {
+        http.Error(w, "Admin not found", http.StatusNotFound)
+        return
+    }
+    if accountRole(account) == RoleAdmin && role != RoleAdmin && adminCount() == 1 {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Cannot demote the last admin"})
+        return
+    }
+
+    previous := account.Role
+    account.Role = role
+    adminAccounts[username] = account
+    if err := saveAdmins(); err != nil {
+        account.Role = previous
+        adminAccounts[username] = account
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving admins"})
+        return
+    }
+    recordAudit(admin, "set-admin-role", username+" as "+string(role))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Role updated successfully"})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+)
+
+// writeJSONError answers with {"error": message} and the given status.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// allowMethod reports whether r uses one of methods. Otherwise it answers
+// 405 with the allowed methods and the caller should return.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+    for _, m := range methods {
+        if r.Method == m {
+            return true
+        }
+    }
+    w.Header().Set("Allow", strings.Join(methods, ", "))
+    writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+    return false
+}
+
+// apiNotFoundHandler catches every /api/ path without its own handler.
+func apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+    writeJSONError(w, http.StatusNotFound, "not found")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "encoding/base64"
+    "errors"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+var audioExtensions = map[string]string{
+    "audio/mpeg": ".mp3",
+    "audio/mp3":  ".mp3",
+    "audio/wav":  ".wav",
+    "audio/ogg":  ".ogg",
+    "audio/webm": ".webm",
+    "audio/mp4":  ".m4a",
+}
+
+// decodeAudio parses a base64 data URL and returns the audio bytes and the
+// file extension for its type.
+func decodeAudio(dataURL string) ([]byte, string, error) {
+    parts := strings.SplitN(dataURL, ",", 2)
+    if len(parts) != 2 || !strings.HasPrefix(parts[0], "data:") || !strings.HasSuffix(parts[0], ";base64") {
+        return nil, "", errors.New("Invalid audio format")
+    }
+
+    mimeType := strings.TrimSuffix(strings.TrimPrefix(parts[0], "data:"), ";base64")
+    ext, ok := audioExtensions[mimeType]
+    if !ok {
+        return nil, "", errors.New("Unsupported audio type")
+    }
+
+    decoded, err := base64.StdEncoding.DecodeString(parts[1])
+    if err != nil {
+        return nil, "", errors.New("Error decoding audio")
+    }
+    return decoded, ext, nil
+}
+
+// saveQuestionAudio writes a question's audio clip and returns its path.
+func saveQuestionAudio(questionID int, audio []byte, ext string) (string, error) {
+    path := filepath.Join("question_audio", strconv.Itoa(questionID)+ext)
+    if err := ioutil.WriteFile(path, audio, 0644); err != nil {
+        return "", err
+    }
+    return path, nil
+}
+
+// questionAudioURL returns the URL a question's audio is served from.
+func questionAudioURL(path string) string {
+    if path == "" {
+        return ""
+    }
+    return "/question-audio/" + filepath.Base(path)
+}
+
+// questionMediaURLs returns the URLs of the media q shows, or nil if it has
+// none.
+func questionMediaURLs(q Question) []string {
+    if q.AudioPath == "" {
+        return nil
+    }
+    return []string{questionAudioURL(q.AudioPath)}
+}
+
+// Serve a question's audio clip
+func serveQuestionAudio(w http.ResponseWriter, r *http.Request) {
+    name := strings.TrimPrefix(r.URL.Path, "/question-audio/")
+    if !validPathName(name) {
+        http.NotFound(w, r)
+        return
+    }
+
+    audioPath := filepath.Join("question_audio", name)
+
+    if _, err := os.Stat(audioPath); os.IsNotExist(err) {
+        http.NotFound(w, r)
+        return
+    }
+
+    http.ServeFile(w, r, audioPath)
+}
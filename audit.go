@@ -0,0 +1,38 @@
+package main
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "time"
+)
+
+// AuditEntry records a sensitive admin action.
+type AuditEntry struct {
+    Time   time.Time
+    Admin  string
+    Action string
+    Detail string
+}
+
+var auditLog []AuditEntry
+
+// recordAudit appends an entry to the audit log. Caller must hold mu.
+func recordAudit(admin, action, detail string) {
+    auditLog = append(auditLog, AuditEntry{
+        Time:   time.Now(),
+        Admin:  admin,
+        Action: action,
+        Detail: detail,
+    })
+    log.Printf("audit: %s %s %s", admin, action, detail)
+}
+
+// API endpoint to list the audit log
+func auditLogHandler(w http.ResponseWriter, r *http.Request) {
+    mu.Lock()
+    defer mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(auditLog)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "time"
+)
+
+const adminSessionCookie = "admin_session"
+
+// Admin session tokens mapped to the admin's username
+var adminSessions = make(map[string]string)
+
+func newSessionToken() string {
+    b := make([]byte, 32)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// startAdminSession issues a session cookie for an authenticated admin.
+func startAdminSession(w http.ResponseWriter, username string) {
+    token := newSessionToken()
+
+    mu.Lock()
+    adminSessions[token] = username
+    mu.Unlock()
+
+    http.SetCookie(w, &http.Cookie{
+        Name:     adminSessionCookie,
+        Value:    token,
+        Path:     "/",
+        HttpOnly: true,
+        SameSite: http.SameSiteLaxMode,
+    })
+}
+
+// adminFromRequest returns the admin behind the request's session cookie.
+func adminFromRequest(r *http.Request) (string, bool) {
+    cookie, err := r.Cookie(adminSessionCookie)
+    if err != nil {
+        return "", false
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    username, ok := adminSessions[cookie.Value]
+    return username, ok
+}
+
+// requireAdmin only lets requests with a valid admin session through.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if _, ok := adminFromRequest(r); !ok {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+        next(w, r)
+    }
+}
+
+const confirmationTTL = 5 * time.Minute
+
+type confirmation struct {
+    Action  string
+    Expires time.Time
+}
+
+// One-time tokens confirming destructive admin actions
+var confirmations = make(map[string]confirmation)
+
+// consumeConfirmation reports whether token confirms action, invalidating it.
+// Caller must hold mu.
+func consumeConfirmation(action, token string) bool {
+    c, ok := confirmations[token]
+    if !ok {
+        return false
+    }
+    delete(confirmations, token)
+    return c.Action == action && time.Now().Before(c.Expires)
+}
+
+// API endpoint issuing a short-lived token that must accompany a destructive action
+func confirmTokenHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    action := r.FormValue("action")
+    if action == "" {
+        http.Error(w, "Action not specified", http.StatusBadRequest)
+        return
+    }
+
+    token := newSessionToken()
+    expires := time.Now().Add(confirmationTTL)
+
+    mu.Lock()
+    for t, c := range confirmations {
+        if time.Now().After(c.Expires) {
+            delete(confirmations, t)
+        }
+    }
+    confirmations[token] = confirmation{Action: action, Expires: expires}
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "action": action, "expires": expires})
+}
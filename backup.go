@@ -0,0 +1,232 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+)
+
+// backupSchemaVersion is the version backups are written with. Version 1
+// backups lack the reference face images and question flags and can still
+// be restored.
+const backupSchemaVersion = 2
+
+// Backup is a complete snapshot of the application's state.
+type Backup struct {
+    SchemaVersion int
+    CreatedAt     time.Time
+
+    Students       []Student
+    Accounts       []string          // Every username that can log in as a student
+    Passwords      map[string]string `json:",omitempty"` // Only when Config.BackupIncludePasswords is set
+    ReferenceFaces map[string]string
+    // ReferenceFaceImages holds the image behind each reference face, since
+    // students are rebuilt from reference_faces/ at startup.
+    ReferenceFaceImages map[string][]byte `json:",omitempty"`
+
+    Exams           []Exam
+    Questions       []Question
+    Results         []Result
+    Violations      []Violation
+    ViolationEvents []ViolationEvent
+    QuestionFlags   []QuestionFlag
+
+    ExamIDCounter      int
+    QuestionIDCounter  int
+    ViolationIDCounter int
+}
+
+// API endpoint dumping all application state as one JSON document
+func backupHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    mu.Lock()
+    backup := Backup{
+        SchemaVersion:      backupSchemaVersion,
+        CreatedAt:          time.Now(),
+        Students:           students,
+        ReferenceFaces:     userReferenceFaces,
+        Exams:              exams,
+        Questions:          questions,
+        Results:            results,
+        Violations:         violations,
+        ViolationEvents:    violationEvents,
+        QuestionFlags:      questionFlags,
+        ExamIDCounter:      examIDCounter,
+        QuestionIDCounter:  questionIDCounter,
+        ViolationIDCounter: violationIDCounter,
+    }
+    for username := range studentUser {
+        backup.Accounts = append(backup.Accounts, username)
+    }
+    sort.Strings(backup.Accounts)
+    backup.ReferenceFaceImages = make(map[string][]byte, len(userReferenceFaces))
+    for username, path := range userReferenceFaces {
+        image, err := ioutil.ReadFile(path)
+        if err != nil {
+            log.Printf("backup: leaving out the reference face of %s: %v", username, err)
+            continue
+        }
+        backup.ReferenceFaceImages[username] = image
+    }
+    if cfg.BackupIncludePasswords {
+        backup.Passwords = studentUser
+    }
+
+    // Encode while still holding the lock since the snapshot shares its slices.
+    body, err := json.Marshal(backup)
+    mu.Unlock()
+    if err != nil {
+        http.Error(w, "Error creating backup", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"backup-%s.json\"", backup.CreatedAt.Format("20060102-150405")))
+    w.Write(body)
+}
+
+// API endpoint replacing all application state with a backup. It requires a
+// "restore" confirmation token and is refused while exams are being taken,
+// since their attempts refer to questions and exams the backup may not have.
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    var backup Backup
+    if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
+        http.Error(w, "Error parsing backup", http.StatusBadRequest)
+        return
+    }
+    if backup.SchemaVersion < 1 || backup.SchemaVersion > backupSchemaVersion {
+        http.Error(w, fmt.Sprintf("Unsupported backup schema version %d (expected %d)", backup.SchemaVersion, backupSchemaVersion), http.StatusBadRequest)
+        return
+    }
+    // Reference face paths are later removed from disk, so an edited backup
+    // must not be able to point them anywhere else.
+    for username, path := range backup.ReferenceFaces {
+        if !validPathName(username) || path != referenceFacePath(username) {
+            http.Error(w, fmt.Sprintf("Invalid reference face for %q", username), http.StatusBadRequest)
+            return
+        }
+    }
+    for username := range backup.ReferenceFaceImages {
+        if _, ok := backup.ReferenceFaces[username]; !ok {
+            http.Error(w, fmt.Sprintf("Reference face image for %q has no reference face", username), http.StatusBadRequest)
+            return
+        }
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if len(examSessions) > 0 {
+        http.Error(w, fmt.Sprintf("%d exam sessions are active; restore once they have ended", len(examSessions)), http.StatusConflict)
+        return
+    }
+    if !consumeConfirmation("restore", r.URL.Query().Get("confirm")) {
+        http.Error(w, "Missing or invalid confirmation token", http.StatusForbidden)
+        return
+    }
+
+    // Accounts missing from the backup's passwords keep their current one.
+    passwords := make(map[string]string)
+    for _, username := range backup.Accounts {
+        if pass, ok := backup.Passwords[username]; ok {
+            passwords[username] = pass
+        } else if pass, ok := studentUser[username]; ok {
+            passwords[username] = pass
+        }
+    }
+    if backup.ReferenceFaces == nil {
+        backup.ReferenceFaces = make(map[string]string)
+    }
+    for username, image := range backup.ReferenceFaceImages {
+        if err := ioutil.WriteFile(referenceFacePath(username), image, 0644); err != nil {
+            log.Printf("restore: writing reference face of %s: %v", username, err)
+            http.Error(w, "Error writing reference faces", http.StatusInternalServerError)
+            return
+        }
+    }
+    // Faces left over from students the backup doesn't have would bring them
+    // back at the next startup.
+    for username, path := range userReferenceFaces {
+        if _, ok := backup.ReferenceFaces[username]; !ok {
+            os.Remove(path)
+        }
+    }
+    // Students whose face is neither in the backup nor on disk can't be
+    // rebuilt at the next startup.
+    var missingFaces []string
+    for username, path := range backup.ReferenceFaces {
+        if _, err := os.Stat(path); err != nil {
+            missingFaces = append(missingFaces, username)
+        }
+    }
+    sort.Strings(missingFaces)
+
+    students = backup.Students
+    studentUser = passwords
+    userReferenceFaces = backup.ReferenceFaces
+    exams = backup.Exams
+    questions = backup.Questions
+    results = backup.Results
+    violations = backup.Violations
+    violationEvents = backup.ViolationEvents
+    // Flags refer to question IDs, so they must come from the same backup.
+    questionFlags = backup.QuestionFlags
+    // Counters from a stale or edited backup must not hand out IDs in use,
+    // and IDs start at 1.
+    examIDCounter = nextIDAfter(backup.ExamIDCounter, 0)
+    for _, e := range exams {
+        examIDCounter = nextIDAfter(examIDCounter, e.ID)
+    }
+    questionIDCounter = nextIDAfter(backup.QuestionIDCounter, 0)
+    for _, q := range questions {
+        questionIDCounter = nextIDAfter(questionIDCounter, q.ID)
+    }
+    violationIDCounter = nextIDAfter(backup.ViolationIDCounter, 0)
+    for _, e := range violationEvents {
+        violationIDCounter = nextIDAfter(violationIDCounter, e.ID)
+    }
+    // Question positions of sessionless attempts refer to the old bank.
+    userQuestionIndex = make(map[string]int)
+    userQuestionIDs = make(map[string][]int)
+    if err := saveExams(); err != nil {
+        log.Printf("saving %s: %v", examsFile, err)
+    }
+    if err := saveResults(); err != nil {
+        log.Printf("saving %s: %v", resultsFile, err)
+    }
+    saveQuestions()
+    saveViolations()
+    if err := saveJSON(questionFlagsFile, questionFlags); err != nil {
+        log.Printf("saving %s: %v", questionFlagsFile, err)
+    }
+
+    message := "State restored"
+    if len(missingFaces) > 0 {
+        message = fmt.Sprintf("State restored; %d students have no reference face and will be gone after a restart: %s", len(missingFaces), strings.Join(missingFaces, ", "))
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": message})
+}
+
+// referenceFacePath returns where username's reference face is stored.
+func referenceFacePath(username string) string {
+    return filepath.Join("reference_faces", username+".jpg")
+}
+
+// nextIDAfter returns counter, raised if needed so it is past id.
+func nextIDAfter(counter, id int) int {
+    if id >= counter {
+        return id + 1
+    }
+    return counter
+}
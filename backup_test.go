@@ -0,0 +1,67 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+)
+
+// restore posts backup to the restore endpoint with a fresh confirmation.
+func restore(backup Backup) *httptest.ResponseRecorder {
+    mu.Lock()
+    confirmations["restore-test"] = confirmation{Action: "restore", Expires: time.Now().Add(time.Minute)}
+    mu.Unlock()
+    body, _ := json.Marshal(backup)
+    r := httptest.NewRequest("POST", "/restore?confirm=restore-test", bytes.NewReader(body))
+    w := httptest.NewRecorder()
+    restoreHandler(w, r)
+    return w
+}
+
+func TestRestoreRejectsForeignFacePaths(t *testing.T) {
+    resetState(t, 1)
+    for _, path := range []string{"main.go", "reference_faces/../main.go", "reference_faces/bob.jpg", "/etc/passwd"} {
+        w := restore(Backup{SchemaVersion: backupSchemaVersion, ReferenceFaces: map[string]string{"alice": path}})
+        if w.Code != 400 {
+            t.Errorf("reference face %q: got %d %s, want 400", path, w.Code, w.Body.String())
+        }
+    }
+}
+
+func TestRestoreWritesFacesAndFlags(t *testing.T) {
+    resetState(t, 1)
+    os.MkdirAll("reference_faces", os.ModePerm)
+    defer os.RemoveAll("reference_faces")
+    ioutil.WriteFile(referenceFacePath("stale"), []byte("old"), 0644)
+    mu.Lock()
+    userReferenceFaces = map[string]string{"stale": referenceFacePath("stale")}
+    mu.Unlock()
+    defer func() { questionFlags = nil }()
+
+    w := restore(Backup{
+        SchemaVersion:       backupSchemaVersion,
+        Students:            []Student{{Username: "alice"}},
+        ReferenceFaces:      map[string]string{"alice": referenceFacePath("alice")},
+        ReferenceFaceImages: map[string][]byte{"alice": []byte("face")},
+        Questions:           []Question{{ID: 5, Text: "?", Options: []string{"a", "b"}, Answer: "0", Time: 30}},
+        QuestionFlags:       []QuestionFlag{{QuestionID: 5, Username: "alice"}},
+    })
+    if w.Code != 200 {
+        t.Fatalf("restoring: %d %s", w.Code, w.Body.String())
+    }
+    if image, err := ioutil.ReadFile(referenceFacePath("alice")); err != nil || string(image) != "face" {
+        t.Errorf("reference face not written: %q %v", image, err)
+    }
+    if _, err := os.Stat(referenceFacePath("stale")); !os.IsNotExist(err) {
+        t.Errorf("face of a student not in the backup was kept: %v", err)
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if len(questionFlags) != 1 || questionFlags[0].QuestionID != 5 {
+        t.Errorf("question flags = %+v, want the backup's", questionFlags)
+    }
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+    "archive/zip"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// When each user's last capture was accepted for analysis
+var lastCaptureAccepted = make(map[string]time.Time)
+
+// captureThrottled reports whether a capture from username arrives sooner
+// than Config.MinCaptureIntervalMillis after the last accepted one, and
+// otherwise marks it accepted. Caller must hold mu.
+func captureThrottled(cfg *Config, username string, now time.Time) bool {
+    interval := time.Duration(cfg.MinCaptureIntervalMillis) * time.Millisecond
+    if last, ok := lastCaptureAccepted[username]; ok && interval > 0 && now.Sub(last) < interval {
+        return true
+    }
+    lastCaptureAccepted[username] = now
+    return false
+}
+
+// validPathName reports whether name is safe to use as a single path element.
+func validPathName(name string) bool {
+    return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// saveCapture stores a data-URL frame under captured_images/<username>/ and
+// returns its path, or "" if the frame could not be saved.
+func saveCapture(username, imgData string) string {
+    if !validPathName(username) {
+        return ""
+    }
+
+    parts := strings.Split(imgData, ",")
+    if len(parts) != 2 {
+        return ""
+    }
+
+    decoded, err := base64.StdEncoding.DecodeString(parts[1])
+    if err != nil {
+        return ""
+    }
+
+    dir := filepath.Join("captured_images", username)
+    if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+        return ""
+    }
+
+    path := filepath.Join(dir, time.Now().Format(captureTimeLayout)+".png")
+    if err := ioutil.WriteFile(path, decoded, 0644); err != nil {
+        return ""
+    }
+    return path
+}
+
+// moveCaptures moves every capture of from into to's directory and returns
+// the new path of each moved file by its old one. A frame whose name is
+// taken in to's directory gets from's name as a suffix.
+func moveCaptures(from, to string) (map[string]string, error) {
+    moved := make(map[string]string)
+    if !validPathName(from) || !validPathName(to) {
+        return moved, fmt.Errorf("invalid user")
+    }
+    src := filepath.Join("captured_images", from)
+    files, err := ioutil.ReadDir(src)
+    if os.IsNotExist(err) {
+        return moved, nil
+    } else if err != nil {
+        return moved, err
+    }
+    dst := filepath.Join("captured_images", to)
+    if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+        return moved, err
+    }
+
+    for _, file := range files {
+        if file.IsDir() {
+            continue
+        }
+        oldPath := filepath.Join(src, file.Name())
+        newPath := filepath.Join(dst, file.Name())
+        if _, err := os.Stat(newPath); err == nil {
+            ext := filepath.Ext(file.Name())
+            newPath = filepath.Join(dst, strings.TrimSuffix(file.Name(), ext)+"-"+from+ext)
+        }
+        if err := os.Rename(oldPath, newPath); err != nil {
+            return moved, err
+        }
+        moved[oldPath] = newPath
+    }
+    os.Remove(src) // Only if nothing else was left in it
+    return moved, nil
+}
+
+// captureURL returns the URL a saved capture is served from.
+func captureURL(path string) string {
+    rel, err := filepath.Rel("captured_images", path)
+    if err != nil {
+        return ""
+    }
+    return "/captured-images/" + filepath.ToSlash(rel)
+}
+
+// Serve a captured image to an admin
+func serveCapturedImage(w http.ResponseWriter, r *http.Request) {
+    parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/captured-images/"), "/")
+    if len(parts) != 2 || !validPathName(parts[0]) || !validPathName(parts[1]) {
+        http.NotFound(w, r)
+        return
+    }
+
+    imagePath := filepath.Join("captured_images", parts[0], parts[1])
+
+    if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+        http.NotFound(w, r)
+        return
+    }
+
+    http.ServeFile(w, r, imagePath)
+}
+
+// API endpoint serving the capture that triggered a violation event
+func violationImageHandler(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.URL.Query().Get("id"))
+    if err != nil {
+        http.Error(w, "Invalid violation ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    imagePath, found := "", false
+    for _, e := range violationEvents {
+        if e.ID == id {
+            imagePath, found = e.ImagePath, true
+            break
+        }
+    }
+    mu.Unlock()
+
+    if !found {
+        writeJSONError(w, http.StatusNotFound, "violation not found")
+        return
+    }
+    if imagePath == "" {
+        writeJSONError(w, http.StatusNotFound, "violation has no image")
+        return
+    }
+
+    // Only serve paths of the form captured_images/<user>/<file>.
+    parts := strings.Split(filepath.ToSlash(imagePath), "/")
+    if len(parts) != 3 || parts[0] != "captured_images" || !validPathName(parts[1]) || !validPathName(parts[2]) {
+        writeJSONError(w, http.StatusNotFound, "violation has no image")
+        return
+    }
+    imagePath = filepath.Join(parts...)
+    if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+        writeJSONError(w, http.StatusNotFound, "image has been purged")
+        return
+    }
+
+    http.ServeFile(w, r, imagePath)
+}
+
+// API endpoint streaming captured images as a zip: all of a student's with
+// ?user=, or those that triggered violations in an exam with ?exam=
+// (optionally narrowed to one student)
+func downloadCapturesHandler(w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    examID := 0
+    if r.URL.Query().Get("exam") != "" {
+        id, ok := examIDParam(r, "exam")
+        if !ok {
+            http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+            return
+        }
+        examID = id
+    }
+    if username == "" && examID == 0 {
+        http.Error(w, "User or exam not specified", http.StatusBadRequest)
+        return
+    }
+    if username != "" && !validPathName(username) {
+        http.Error(w, "Invalid user", http.StatusBadRequest)
+        return
+    }
+
+    var paths []string
+    if examID == 0 {
+        dir := filepath.Join("captured_images", username)
+        files, err := ioutil.ReadDir(dir)
+        if err != nil {
+            http.NotFound(w, r)
+            return
+        }
+        for _, file := range files {
+            if !file.IsDir() {
+                paths = append(paths, filepath.Join(dir, file.Name()))
+            }
+        }
+    } else {
+        mu.Lock()
+        for _, e := range violationEvents {
+            if e.ExamID == examID && e.ImagePath != "" && (username == "" || e.Username == username) {
+                paths = append(paths, e.ImagePath)
+            }
+        }
+        mu.Unlock()
+    }
+
+    name := username
+    if examID != 0 {
+        name = fmt.Sprintf("exam%d", examID)
+        if username != "" {
+            name += "-" + username
+        }
+    }
+    w.Header().Set("Content-Type", "application/zip")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"captures-%s.zip\"", name))
+
+    // Files are copied one at a time straight into the response.
+    zw := zip.NewWriter(w)
+    for _, path := range paths {
+        rel, err := filepath.Rel("captured_images", path)
+        if err != nil || strings.HasPrefix(rel, "..") {
+            continue
+        }
+        f, err := os.Open(path)
+        if err != nil {
+            continue // Purged since it was listed
+        }
+        entry, err := zw.Create(filepath.ToSlash(rel))
+        if err == nil {
+            _, err = io.Copy(entry, f)
+        }
+        f.Close()
+        if err != nil {
+            log.Printf("download captures: %v", err)
+            return
+        }
+    }
+    if err := zw.Close(); err != nil {
+        log.Printf("download captures: %v", err)
+    }
+}
+
+// captureTimeLayout is the timestamp saveCapture names frames with.
+const captureTimeLayout = "20060102_150405.000"
+
+// captureTime returns when a capture was taken, from its file name when
+// saveCapture named it and otherwise from its modification time.
+func captureTime(path string, info os.FileInfo) time.Time {
+    name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+    if t, err := time.ParseInLocation(captureTimeLayout, name, time.Local); err == nil {
+        return t
+    }
+    return info.ModTime()
+}
+
+// API endpoint listing every student's captures taken between from and to
+// (RFC 3339, either may be omitted), oldest first, a page at a time
+func searchCapturesHandler(w http.ResponseWriter, r *http.Request) {
+    type captureEntry struct {
+        Username string
+        Time     time.Time
+        URL      string
+    }
+
+    var from, to time.Time
+    for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+        if v := r.URL.Query().Get(name); v != "" {
+            t, err := time.Parse(time.RFC3339, v)
+            if err != nil {
+                http.Error(w, "Invalid "+name+" time", http.StatusBadRequest)
+                return
+            }
+            *dst = t
+        }
+    }
+    page, perPage := 1, 100
+    if v := r.URL.Query().Get("page"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 {
+            http.Error(w, "Invalid page", http.StatusBadRequest)
+            return
+        }
+        page = n
+    }
+    if v := r.URL.Query().Get("per_page"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > 1000 {
+            http.Error(w, "Invalid per_page", http.StatusBadRequest)
+            return
+        }
+        perPage = n
+    }
+
+    matches := []captureEntry{}
+    filepath.Walk("captured_images", func(path string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() {
+            return nil
+        }
+        t := captureTime(path, info)
+        if (!from.IsZero() && t.Before(from)) || (!to.IsZero() && t.After(to)) {
+            return nil
+        }
+        matches = append(matches, captureEntry{
+            Username: filepath.Base(filepath.Dir(path)),
+            Time:     t,
+            URL:      captureURL(path),
+        })
+        return nil
+    })
+    sort.Slice(matches, func(i, j int) bool { return matches[i].Time.Before(matches[j].Time) })
+
+    total := len(matches)
+    start := (page - 1) * perPage
+    if start > total {
+        start = total
+    }
+    end := start + perPage
+    if end > total {
+        end = total
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "total":    total,
+        "page":     page,
+        "perPage":  perPage,
+        "captures": matches[start:end],
+    })
+}
+
+// runCaptureCleanup periodically purges captured images older than the
+// configured retention. It does nothing when retention is zero.
+func runCaptureCleanup(cfg *Config) {
+    if cfg.CaptureRetentionHours <= 0 {
+        return
+    }
+
+    ticker := time.NewTicker(time.Duration(cfg.CleanupIntervalMinutes) * time.Minute)
+    defer ticker.Stop()
+
+    for {
+        purged := purgeOldCaptures(time.Now().Add(-time.Duration(cfg.CaptureRetentionHours) * time.Hour))
+        log.Printf("capture cleanup: purged %d images", purged)
+        <-ticker.C
+    }
+}
+
+// purgeOldCaptures deletes captured images last modified before cutoff and
+// returns how many were removed. Images that are evidence for a recorded
+// violation are kept.
+func purgeOldCaptures(cutoff time.Time) int {
+    mu.Lock()
+    evidence := make(map[string]bool)
+    for _, e := range violationEvents {
+        if e.ImagePath != "" {
+            evidence[filepath.Clean(e.ImagePath)] = true
+        }
+    }
+    mu.Unlock()
+
+    purged := 0
+    filepath.Walk("captured_images", func(path string, info os.FileInfo, err error) error {
+        if err != nil || info.IsDir() {
+            return nil
+        }
+        if info.ModTime().After(cutoff) || evidence[filepath.Clean(path)] {
+            return nil
+        }
+        if err := os.Remove(path); err != nil {
+            log.Printf("capture cleanup: %v", err)
+            return nil
+        }
+        purged++
+        return nil
+    })
+    return purged
+}
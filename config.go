@@ -0,0 +1,560 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// PasswordPolicy is the minimum strength required of new passwords.
+type PasswordPolicy struct {
+    MinLength     int
+    RequireUpper  bool
+    RequireLower  bool
+    RequireDigit  bool
+    RequireSymbol bool
+}
+
+// SMTPConfig is the mail server used for proctor notifications.
+type SMTPConfig struct {
+    Host     string
+    Port     int
+    Username string
+    Password string
+    From     string
+}
+
+// FocusLossStep multiplies the weight of a tab or window change that kept
+// the exam out of focus for longer than AfterSeconds.
+type FocusLossStep struct {
+    AfterSeconds int
+    Multiplier   int
+}
+
+// Config holds the tunable proctoring settings shared by the handlers. It
+// starts from the defaults below, then an optional JSON file named by the
+// -config flag, then PROCTOR_* environment variables.
+type Config struct {
+    // ListenAddr is the address the HTTP server listens on.
+    ListenAddr string
+    // FaceServiceURL is the base URL of the Python face analysis service.
+    FaceServiceURL string
+    // FaceServiceConcurrency is the most calls to the face service that may
+    // be in flight at once.
+    FaceServiceConcurrency int
+    // FaceServiceQueueMillis is how long a call waits for a free slot before
+    // the student is asked to try again.
+    FaceServiceQueueMillis int
+    // FaceServiceTimeoutSeconds is the longest a face service call may take.
+    FaceServiceTimeoutSeconds int
+    // FaceServiceFailureThreshold is how many face service calls in a row
+    // may fail before calls stop being made for FaceServiceProbeSeconds.
+    FaceServiceFailureThreshold int
+    FaceServiceProbeSeconds     int
+    // FaceServiceSoftFail treats a face service response the server doesn't
+    // recognize as a failed check (a skipped frame for captures) instead of
+    // answering with an UNKNOWN_RESPONSE error. Either way it is logged.
+    FaceServiceSoftFail bool
+
+    // MaxViolations is the weighted violation total at which an exam is terminated.
+    MaxViolations int
+    // ViolationWeights maps a violation type to how much it adds to the total.
+    // Types that are not listed count as 1.
+    ViolationWeights map[string]int
+    // GraceWindows maps a violation type to a number of seconds during which
+    // repeated reports of the same type are not counted again.
+    GraceWindows map[string]int
+    // FocusLossSteps weight tab and window changes by how long focus was
+    // away. The largest Multiplier whose AfterSeconds was exceeded applies;
+    // shorter or unreported durations count once.
+    FocusLossSteps []FocusLossStep
+    // CaptureInterval is how often, in seconds, the proctor page sends a frame.
+    CaptureInterval int
+    // MinCaptureIntervalMillis is the shortest time between two captures from
+    // one student that are passed on for analysis; faster ones are dropped.
+    // Zero disables throttling.
+    MinCaptureIntervalMillis int
+    // MaxCaptureGap is how many seconds may pass without a capture before a
+    // MONITORING_GAP violation is recorded. Zero disables the check.
+    MaxCaptureGap int
+
+    // ViolationWebhookURL receives every recorded violation when set.
+    ViolationWebhookURL string
+    // WebhookSecret signs webhook payloads so receivers can verify them.
+    WebhookSecret string
+    // CompletionWebhookURL receives the receipt of every finished attempt when set.
+    CompletionWebhookURL string
+    // CompletionWebhookSecret signs completion payloads; WebhookSecret is
+    // used when it is empty.
+    CompletionWebhookSecret string
+    // WebhookMaxAttempts is how many times a delivery is tried before it is dropped.
+    WebhookMaxAttempts int
+
+    // NotifyEmail is told by email when a student reaches MaxViolations.
+    // Notifications are off while it is empty.
+    NotifyEmail string
+    // SMTP is the server notification emails are sent through.
+    SMTP SMTPConfig
+    // EmailMaxAttempts is how many times an email is tried before it is dropped.
+    EmailMaxAttempts int
+
+    // CaptureRetentionHours is how long captured images are kept. Zero keeps
+    // them forever and disables the cleanup job.
+    CaptureRetentionHours int
+    // AnswerRetentionDays is how long the answers stored with each result
+    // are kept; the score stays. Zero keeps them forever.
+    AnswerRetentionDays int
+    // CleanupIntervalMinutes is how often the cleanup jobs run.
+    CleanupIntervalMinutes int
+
+    // TrustedProxies lists the IPs or CIDRs of reverse proxies whose
+    // X-Forwarded-For header is believed. Empty trusts no one.
+    TrustedProxies []string
+    // ExamAllowedNetworks lists the IPs or CIDRs students may log in and take
+    // exams from. Empty allows every address not denied.
+    ExamAllowedNetworks []string
+    // ExamDeniedNetworks lists IPs or CIDRs students may never use; it wins
+    // over ExamAllowedNetworks.
+    ExamDeniedNetworks []string
+
+    // BackupIncludePasswords adds student passwords to /api/backup.
+    BackupIncludePasswords bool
+
+    // IdleTimeoutMinutes is how long an exam session may go without activity
+    // before it is recorded as abandoned. Exams can override it; zero disables.
+    IdleTimeoutMinutes int
+    // MaxSessionLifetimeMinutes is the longest any exam session may exist,
+    // active or not, before it is ended and its saved answers submitted.
+    // Zero disables the cap.
+    MaxSessionLifetimeMinutes int
+    // SubmitGraceSeconds is how long after a time bank runs out a final
+    // submission is still graded in full, beyond the few seconds always
+    // allowed for latency. Such results are marked SubmittedInGrace.
+    SubmitGraceSeconds int
+    // SweepIntervalSeconds is how often sessions are checked for expiry.
+    SweepIntervalSeconds int
+
+    // SelfEnrollment lets a student without a reference face log in, using
+    // the photo captured at login as their reference face. Otherwise they are
+    // turned away until an admin adds one.
+    SelfEnrollment bool
+
+    // LoginNotice is a monitoring or consent notice, which may contain HTML,
+    // that students must accept before logging in. Empty disables it.
+    LoginNotice string
+
+    // SkipReferenceFaceCheck stores reference faces without asking the face
+    // service to confirm they show exactly one face, for offline setups.
+    SkipReferenceFaceCheck bool
+
+    // OfflineAfterSeconds is how long a session may go without a heartbeat
+    // before its student is shown as offline.
+    OfflineAfterSeconds int
+
+    // FastAnswerSeconds flags answers given sooner than this after the
+    // question was served. Zero disables the flag.
+    FastAnswerSeconds int
+
+    // CaseSensitiveAnswers makes multiple choice answers given as option text
+    // match only with the same case.
+    CaseSensitiveAnswers bool
+    // PreloadMedia sends the next question's media URLs with each question
+    // so the page can fetch them ahead of time.
+    PreloadMedia bool
+
+    // MinOptions and MaxOptions bound how many options a multiple choice
+    // question may have. MaxOptions also caps the items of ordering and
+    // matching questions.
+    MinOptions int
+    MaxOptions int
+
+    // PasswordPolicy applies to student and admin passwords as they are set.
+    PasswordPolicy PasswordPolicy
+
+    // ReceiptSecret signs result receipts. When unset a random secret is
+    // generated on first run and kept in the data directory, so receipts
+    // still verify after a restart.
+    ReceiptSecret string
+
+    // File is the -config file the settings were loaded from, if any.
+    File string `json:"-"`
+}
+
+// defaultConfig returns the settings used wherever neither the config file
+// nor the environment sets one.
+func defaultConfig() Config {
+    return Config{
+        ListenAddr:     ":8080",
+        FaceServiceURL: "http://localhost:5000",
+
+        FaceServiceConcurrency: 8,
+        FaceServiceQueueMillis: 2000,
+
+        FaceServiceTimeoutSeconds:   10,
+        FaceServiceFailureThreshold: 5,
+        FaceServiceProbeSeconds:     30,
+
+        MaxViolations: 10,
+        ViolationWeights: map[string]int{
+            "FULLSCREEN_VIOLATION":    1,
+            "TAB_CHANGE_VIOLATION":    1,
+            "WINDOW_CHANGE_VIOLATION": 1,
+            "GAZE_VIOLATION":          1,
+            "NOISE_VIOLATION":         1,
+            "PROHIBITED_ITEM":         1,
+            "MONITORING_GAP":          1,
+            "FACE_RECHECK_FAILED":     1,
+        },
+        GraceWindows: map[string]int{
+            "FULLSCREEN_VIOLATION":    0,
+            "TAB_CHANGE_VIOLATION":    0,
+            "WINDOW_CHANGE_VIOLATION": 0,
+        },
+        FocusLossSteps: []FocusLossStep{
+            {AfterSeconds: 10, Multiplier: 2},
+            {AfterSeconds: 60, Multiplier: 3},
+        },
+        CaptureInterval: 10,
+        MaxCaptureGap:   30,
+
+        MinCaptureIntervalMillis: 500,
+
+        WebhookMaxAttempts: 8,
+        SMTP:               SMTPConfig{Port: 587},
+        EmailMaxAttempts:   5,
+
+        CleanupIntervalMinutes: 60,
+
+        PreloadMedia: true,
+
+        IdleTimeoutMinutes:   15,
+        SweepIntervalSeconds: 30,
+
+        OfflineAfterSeconds: 15,
+
+        FastAnswerSeconds: 3,
+
+        MinOptions: 2,
+        MaxOptions: 10,
+
+        PasswordPolicy: PasswordPolicy{MinLength: 4},
+    }
+}
+
+// loadConfig returns the settings main passes on to the handlers: the
+// defaults, overlaid by the JSON file at path when it is not empty, then by
+// the environment. It fails listing every problem with the result.
+func loadConfig(path string) (*Config, error) {
+    cfg := defaultConfig()
+    if path != "" {
+        if err := loadConfigFile(&cfg, path); err != nil {
+            return nil, err
+        }
+        cfg.File = path
+    }
+    problems := loadConfigFromEnv(&cfg)
+    normalizeConfig(&cfg)
+    problems = append(problems, validateConfig(&cfg)...)
+    if len(problems) > 0 {
+        return nil, fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+    }
+    return &cfg, nil
+}
+
+// loadConfigFile overlays the JSON file at path onto cfg. Settings the file
+// leaves out keep their value.
+func loadConfigFile(cfg *Config, path string) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    dec := json.NewDecoder(f)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(cfg); err != nil {
+        return fmt.Errorf("%s: %v", path, err)
+    }
+    return nil
+}
+
+// normalizeConfig tidies values however they were set, once the file and
+// the environment have both been applied.
+func normalizeConfig(cfg *Config) {
+    cfg.FaceServiceURL = strings.TrimRight(cfg.FaceServiceURL, "/")
+}
+
+// loadConfigFromEnv overrides cfg with PROCTOR_* environment variables and
+// returns the problems with their values.
+func loadConfigFromEnv(cfg *Config) []string {
+    var problems []string
+    if v := os.Getenv("PROCTOR_LISTEN_ADDR"); v != "" {
+        cfg.ListenAddr = v
+    }
+    if v := os.Getenv("PROCTOR_FACE_SERVICE_URL"); v != "" {
+        cfg.FaceServiceURL = v
+    }
+    envInt(&problems, "PROCTOR_FACE_SERVICE_CONCURRENCY", &cfg.FaceServiceConcurrency, 1)
+    envInt(&problems, "PROCTOR_FACE_SERVICE_QUEUE_MS", &cfg.FaceServiceQueueMillis, 0)
+    envInt(&problems, "PROCTOR_FACE_SERVICE_TIMEOUT_SECONDS", &cfg.FaceServiceTimeoutSeconds, 1)
+    envInt(&problems, "PROCTOR_FACE_SERVICE_FAILURE_THRESHOLD", &cfg.FaceServiceFailureThreshold, 1)
+    envInt(&problems, "PROCTOR_FACE_SERVICE_PROBE_SECONDS", &cfg.FaceServiceProbeSeconds, 1)
+    if v := os.Getenv("PROCTOR_FACE_SERVICE_SOFT_FAIL"); v != "" {
+        cfg.FaceServiceSoftFail = v == "true"
+    }
+    if v := os.Getenv("PROCTOR_VIOLATION_WEBHOOK_URL"); v != "" {
+        cfg.ViolationWebhookURL = v
+    }
+    if v := os.Getenv("PROCTOR_WEBHOOK_SECRET"); v != "" {
+        cfg.WebhookSecret = v
+    }
+    if v := os.Getenv("PROCTOR_COMPLETION_WEBHOOK_URL"); v != "" {
+        cfg.CompletionWebhookURL = v
+    }
+    if v := os.Getenv("PROCTOR_COMPLETION_WEBHOOK_SECRET"); v != "" {
+        cfg.CompletionWebhookSecret = v
+    }
+    envInt(&problems, "PROCTOR_WEBHOOK_MAX_ATTEMPTS", &cfg.WebhookMaxAttempts, 1)
+    if v := os.Getenv("PROCTOR_NOTIFY_EMAIL"); v != "" {
+        cfg.NotifyEmail = v
+    }
+    if v := os.Getenv("PROCTOR_SMTP_HOST"); v != "" {
+        cfg.SMTP.Host = v
+    }
+    envInt(&problems, "PROCTOR_SMTP_PORT", &cfg.SMTP.Port, 1)
+    if v := os.Getenv("PROCTOR_SMTP_USERNAME"); v != "" {
+        cfg.SMTP.Username = v
+    }
+    if v := os.Getenv("PROCTOR_SMTP_PASSWORD"); v != "" {
+        cfg.SMTP.Password = v
+    }
+    if v := os.Getenv("PROCTOR_SMTP_FROM"); v != "" {
+        cfg.SMTP.From = v
+    }
+    envInt(&problems, "PROCTOR_EMAIL_MAX_ATTEMPTS", &cfg.EmailMaxAttempts, 1)
+    envInt(&problems, "PROCTOR_MIN_CAPTURE_INTERVAL_MS", &cfg.MinCaptureIntervalMillis, 0)
+    envInt(&problems, "PROCTOR_CAPTURE_RETENTION_HOURS", &cfg.CaptureRetentionHours, 0)
+    envInt(&problems, "PROCTOR_ANSWER_RETENTION_DAYS", &cfg.AnswerRetentionDays, 0)
+    envInt(&problems, "PROCTOR_CLEANUP_INTERVAL_MINUTES", &cfg.CleanupIntervalMinutes, 1)
+    if v := os.Getenv("PROCTOR_TRUSTED_PROXIES"); v != "" {
+        cfg.TrustedProxies = strings.Split(v, ",")
+    }
+    if v := os.Getenv("PROCTOR_EXAM_ALLOWED_NETWORKS"); v != "" {
+        cfg.ExamAllowedNetworks = strings.Split(v, ",")
+    }
+    if v := os.Getenv("PROCTOR_EXAM_DENIED_NETWORKS"); v != "" {
+        cfg.ExamDeniedNetworks = strings.Split(v, ",")
+    }
+    envInt(&problems, "PROCTOR_IDLE_TIMEOUT_MINUTES", &cfg.IdleTimeoutMinutes, 0)
+    envInt(&problems, "PROCTOR_MAX_SESSION_LIFETIME_MINUTES", &cfg.MaxSessionLifetimeMinutes, 0)
+    envInt(&problems, "PROCTOR_SUBMIT_GRACE_SECONDS", &cfg.SubmitGraceSeconds, 0)
+    envInt(&problems, "PROCTOR_SWEEP_INTERVAL_SECONDS", &cfg.SweepIntervalSeconds, 1)
+    envInt(&problems, "PROCTOR_OFFLINE_AFTER_SECONDS", &cfg.OfflineAfterSeconds, 1)
+    envInt(&problems, "PROCTOR_FAST_ANSWER_SECONDS", &cfg.FastAnswerSeconds, 0)
+    envInt(&problems, "PROCTOR_MIN_OPTIONS", &cfg.MinOptions, 2)
+    envInt(&problems, "PROCTOR_MAX_OPTIONS", &cfg.MaxOptions, 2)
+    envInt(&problems, "PROCTOR_PASSWORD_MIN_LENGTH", &cfg.PasswordPolicy.MinLength, 0)
+    // PROCTOR_PASSWORD_REQUIRE is a comma separated list of upper, lower, digit and symbol.
+    if v := os.Getenv("PROCTOR_PASSWORD_REQUIRE"); v != "" {
+        for _, class := range strings.Split(v, ",") {
+            switch strings.TrimSpace(class) {
+            case "upper":
+                cfg.PasswordPolicy.RequireUpper = true
+            case "lower":
+                cfg.PasswordPolicy.RequireLower = true
+            case "digit":
+                cfg.PasswordPolicy.RequireDigit = true
+            case "symbol":
+                cfg.PasswordPolicy.RequireSymbol = true
+            }
+        }
+    }
+    if v := os.Getenv("PROCTOR_RECEIPT_SECRET"); v != "" {
+        cfg.ReceiptSecret = v
+    }
+    if v := os.Getenv("PROCTOR_SELF_ENROLLMENT"); v != "" {
+        cfg.SelfEnrollment = v == "true"
+    }
+    if v := os.Getenv("PROCTOR_LOGIN_NOTICE"); v != "" {
+        cfg.LoginNotice = v
+    }
+    if v := os.Getenv("PROCTOR_SKIP_REFERENCE_FACE_CHECK"); v != "" {
+        cfg.SkipReferenceFaceCheck = v == "true"
+    }
+    if v := os.Getenv("PROCTOR_CASE_SENSITIVE_ANSWERS"); v != "" {
+        cfg.CaseSensitiveAnswers = v == "true"
+    }
+    if v := os.Getenv("PROCTOR_PRELOAD_MEDIA"); v != "" {
+        cfg.PreloadMedia = v == "true"
+    }
+    if v := os.Getenv("PROCTOR_BACKUP_INCLUDE_PASSWORDS"); v != "" {
+        cfg.BackupIncludePasswords = v == "true"
+    }
+    return problems
+}
+
+// envInt sets *dst from the named variable when it holds an integer >= min.
+// Any other value is added to problems.
+func envInt(problems *[]string, name string, dst *int, min int) {
+    raw := os.Getenv(name)
+    if raw == "" {
+        return
+    }
+    v, err := strconv.Atoi(raw)
+    if err != nil || v < min {
+        *problems = append(*problems, fmt.Sprintf("%s must be an integer >= %d, got %q", name, min, raw))
+        return
+    }
+    *dst = v
+}
+
+// validateConfig returns every problem with the values in cfg.
+func validateConfig(cfg *Config) []string {
+    var problems []string
+    positive := func(name string, v int) {
+        if v <= 0 {
+            problems = append(problems, fmt.Sprintf("%s must be positive, got %d", name, v))
+        }
+    }
+    notNegative := func(name string, v int) {
+        if v < 0 {
+            problems = append(problems, fmt.Sprintf("%s must not be negative, got %d", name, v))
+        }
+    }
+
+    if cfg.ListenAddr == "" {
+        problems = append(problems, "ListenAddr must be set")
+    }
+    if u, err := url.Parse(cfg.FaceServiceURL); err != nil || u.Scheme == "" || u.Host == "" {
+        problems = append(problems, fmt.Sprintf("FaceServiceURL must be an absolute URL, got %q", cfg.FaceServiceURL))
+    }
+    positive("FaceServiceConcurrency", cfg.FaceServiceConcurrency)
+    notNegative("FaceServiceQueueMillis", cfg.FaceServiceQueueMillis)
+    positive("FaceServiceTimeoutSeconds", cfg.FaceServiceTimeoutSeconds)
+    positive("FaceServiceFailureThreshold", cfg.FaceServiceFailureThreshold)
+    positive("FaceServiceProbeSeconds", cfg.FaceServiceProbeSeconds)
+    positive("MaxViolations", cfg.MaxViolations)
+    for violationType, weight := range cfg.ViolationWeights {
+        notNegative("ViolationWeights["+violationType+"]", weight)
+    }
+    for violationType, grace := range cfg.GraceWindows {
+        notNegative("GraceWindows["+violationType+"]", grace)
+    }
+    for i, step := range cfg.FocusLossSteps {
+        notNegative(fmt.Sprintf("FocusLossSteps[%d].AfterSeconds", i), step.AfterSeconds)
+        positive(fmt.Sprintf("FocusLossSteps[%d].Multiplier", i), step.Multiplier)
+    }
+    positive("CaptureInterval", cfg.CaptureInterval)
+    notNegative("MaxCaptureGap", cfg.MaxCaptureGap)
+    notNegative("MinCaptureIntervalMillis", cfg.MinCaptureIntervalMillis)
+    positive("WebhookMaxAttempts", cfg.WebhookMaxAttempts)
+    if cfg.NotifyEmail != "" {
+        if cfg.SMTP.Host == "" || cfg.SMTP.From == "" {
+            problems = append(problems, "SMTP.Host and SMTP.From must be set when NotifyEmail is")
+        }
+        positive("SMTP.Port", cfg.SMTP.Port)
+        positive("EmailMaxAttempts", cfg.EmailMaxAttempts)
+    }
+    notNegative("CaptureRetentionHours", cfg.CaptureRetentionHours)
+    notNegative("AnswerRetentionDays", cfg.AnswerRetentionDays)
+    positive("CleanupIntervalMinutes", cfg.CleanupIntervalMinutes)
+    networkList := func(name string, entries []string) {
+        for _, entry := range entries {
+            if strings.TrimSpace(entry) != "" && len(parseNetworks([]string{entry})) == 0 {
+                problems = append(problems, fmt.Sprintf("%s entry %q is not an IP or CIDR", name, entry))
+            }
+        }
+    }
+    networkList("TrustedProxies", cfg.TrustedProxies)
+    networkList("ExamAllowedNetworks", cfg.ExamAllowedNetworks)
+    networkList("ExamDeniedNetworks", cfg.ExamDeniedNetworks)
+    notNegative("IdleTimeoutMinutes", cfg.IdleTimeoutMinutes)
+    notNegative("MaxSessionLifetimeMinutes", cfg.MaxSessionLifetimeMinutes)
+    notNegative("SubmitGraceSeconds", cfg.SubmitGraceSeconds)
+    positive("SweepIntervalSeconds", cfg.SweepIntervalSeconds)
+    positive("OfflineAfterSeconds", cfg.OfflineAfterSeconds)
+    notNegative("FastAnswerSeconds", cfg.FastAnswerSeconds)
+    if cfg.MinOptions < 2 {
+        problems = append(problems, fmt.Sprintf("MinOptions must be at least 2, got %d", cfg.MinOptions))
+    }
+    if cfg.MaxOptions < cfg.MinOptions {
+        problems = append(problems, fmt.Sprintf("MaxOptions must be at least MinOptions (%d), got %d", cfg.MinOptions, cfg.MaxOptions))
+    }
+    notNegative("PasswordPolicy.MinLength", cfg.PasswordPolicy.MinLength)
+    return problems
+}
+
+// violationWeight returns how much a violation of the given type counts.
+func violationWeight(cfg *Config, violationType string) int {
+    if weight, ok := cfg.ViolationWeights[violationType]; ok {
+        return weight
+    }
+    return 1
+}
+
+// focusLossMultiplier returns how many times a focus loss lasting d counts.
+func focusLossMultiplier(cfg *Config, d time.Duration) int {
+    multiplier := 1
+    for _, step := range cfg.FocusLossSteps {
+        if d > time.Duration(step.AfterSeconds)*time.Second && step.Multiplier > multiplier {
+            multiplier = step.Multiplier
+        }
+    }
+    return multiplier
+}
+
+// redacted replaces a secret in /api/config, leaving empty values empty so
+// it still shows whether the secret is set.
+func redacted(secret string) string {
+    if secret == "" {
+        return ""
+    }
+    return "[redacted]"
+}
+
+// redactedURL keeps only the scheme and host of u for /api/config; webhook
+// URLs often carry a token in their path or query.
+func redactedURL(u string) string {
+    parsed, err := url.Parse(u)
+    if err != nil || parsed.Host == "" {
+        return redacted(u)
+    }
+    if parsed.User == nil && (parsed.Path == "" || parsed.Path == "/") && parsed.RawQuery == "" {
+        return u
+    }
+    return parsed.Scheme + "://" + parsed.Host + "/[redacted]"
+}
+
+// API endpoint returning the configuration the server is running with, for
+// diagnosing a deployment. Secrets, the SMTP password, webhook URL paths and
+// any credentials in the face service URL are redacted.
+func configHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    effective := *cfg
+    effective.WebhookSecret = redacted(cfg.WebhookSecret)
+    effective.CompletionWebhookSecret = redacted(cfg.CompletionWebhookSecret)
+    effective.ReceiptSecret = redacted(cfg.ReceiptSecret)
+    effective.SMTP.Password = redacted(cfg.SMTP.Password)
+    effective.ViolationWebhookURL = redactedURL(cfg.ViolationWebhookURL)
+    effective.CompletionWebhookURL = redactedURL(cfg.CompletionWebhookURL)
+    if parsed, err := url.Parse(cfg.FaceServiceURL); err == nil && parsed.User != nil {
+        parsed.User = url.User("redacted")
+        effective.FaceServiceURL = parsed.String()
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "config":     effective,
+        "configFile": cfg.File,
+        "dataDir":    dataDir,
+        "version":    version,
+    })
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+)
+
+// OptionCount is how many students chose one option of a question.
+type OptionCount struct {
+    Index   int    `json:"index"`
+    Option  string `json:"option"`
+    Count   int    `json:"count"`
+    Correct bool   `json:"correct"`
+}
+
+// QuestionDistribution is how the students who were served a question
+// spread across its options.
+type QuestionDistribution struct {
+    QuestionID int           `json:"questionId"`
+    Text       string        `json:"text"`
+    Options    []OptionCount `json:"options"`
+    Other      int           `json:"other"`      // Answers matching no option
+    Unanswered int           `json:"unanswered"` // Served but left blank
+    // PossibleBadKey is set when a wrong option was chosen more often than
+    // the keyed one, which usually means the key or the wording is off.
+    PossibleBadKey bool `json:"possibleBadKey"`
+}
+
+// API endpoint counting, for each multiple choice question of an exam, how
+// many students chose each option. Each student's latest result with stored
+// answers is used, so results past Config.AnswerRetentionDays are left out.
+// The response shows the key, so every access is audited.
+func answerDistributionHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(examID)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    recordAudit(admin, "view-answer-distribution", fmt.Sprintf("exam %d", examID))
+
+    latest := make(map[string]Result)
+    for _, res := range results {
+        if res.ExamID == examID && res.Answers != nil {
+            latest[res.Username] = res
+        }
+    }
+
+    questions := []QuestionDistribution{}
+    for _, q := range examQuestions(exam) {
+        if q.Type != "" && q.Type != QuestionMultipleChoice {
+            continue
+        }
+        questions = append(questions, answerDistribution(cfg, q, latest))
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "examId":    examID,
+        "students":  len(latest),
+        "questions": questions,
+    })
+}
+
+// answerDistribution counts the answers to q in results. A result counts
+// towards q if q was served in it or it holds an answer to q.
+func answerDistribution(cfg *Config, q Question, results map[string]Result) QuestionDistribution {
+    dist := QuestionDistribution{QuestionID: q.ID, Text: q.Text, Options: make([]OptionCount, len(q.Options))}
+    key, hasKey := optionIndex(cfg, q.Answer, q.Options)
+    for i, option := range q.Options {
+        dist.Options[i] = OptionCount{Index: i, Option: option, Correct: hasKey && i == key}
+    }
+
+    for _, res := range results {
+        answer, served := res.Answers[q.ID]
+        for _, id := range res.QuestionIDs {
+            served = served || id == q.ID
+        }
+        if !served {
+            continue
+        }
+        if answer == "" {
+            dist.Unanswered++
+            continue
+        }
+        if i, ok := optionIndex(cfg, answer, q.Options); ok {
+            dist.Options[i].Count++
+        } else {
+            dist.Other++
+        }
+    }
+
+    if hasKey {
+        for _, option := range dist.Options {
+            if !option.Correct && option.Count > dist.Options[key].Count {
+                dist.PossibleBadKey = true
+            }
+        }
+    }
+    return dist
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// maxFaceComparisonStudents caps how many students /api/duplicate-students
+// compares by face, since every pair costs a face service call.
+const maxFaceComparisonStudents = 100
+
+// DuplicateStudents is a group of accounts that look like the same person.
+type DuplicateStudents struct {
+    Usernames []string
+    Reason    string
+}
+
+// normalizeUsername folds the differences that tell near-duplicate
+// usernames apart: case and anything but letters and digits.
+func normalizeUsername(username string) string {
+    return strings.Map(func(r rune) rune {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return unicode.ToLower(r)
+        }
+        return -1
+    }, username)
+}
+
+// API endpoint listing student accounts that are likely duplicates: those
+// whose usernames only differ in case or punctuation and, with faces=true,
+// those whose reference faces match
+func duplicateStudentsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+    compareFaces := r.URL.Query().Get("faces") == "true"
+
+    mu.Lock()
+    byName := make(map[string][]string)
+    faces := make(map[string]string)
+    for _, s := range students {
+        key := normalizeUsername(s.Username)
+        byName[key] = append(byName[key], s.Username)
+        if path, ok := userReferenceFaces[s.Username]; ok {
+            faces[s.Username] = path
+        }
+    }
+    mu.Unlock()
+
+    groups := []DuplicateStudents{}
+    for _, usernames := range byName {
+        if len(usernames) > 1 {
+            sort.Strings(usernames)
+            groups = append(groups, DuplicateStudents{Usernames: usernames, Reason: "similar username"})
+        }
+    }
+
+    if compareFaces {
+        if len(faces) > maxFaceComparisonStudents {
+            http.Error(w, fmt.Sprintf("Too many students to compare faces (more than %d)", maxFaceComparisonStudents), http.StatusBadRequest)
+            return
+        }
+        usernames := make([]string, 0, len(faces))
+        for username := range faces {
+            usernames = append(usernames, username)
+        }
+        sort.Strings(usernames)
+        for i, a := range usernames {
+            for _, b := range usernames[i+1:] {
+                match, err := referenceFacesMatch(cfg, faces[a], faces[b])
+                if err != nil {
+                    log.Printf("comparing reference faces of %s and %s: %v", a, b, err)
+                    http.Error(w, "Could not compare faces; the face service may be down", http.StatusBadGateway)
+                    return
+                }
+                if match {
+                    groups = append(groups, DuplicateStudents{Usernames: []string{a, b}, Reason: "matching reference face"})
+                }
+            }
+        }
+    }
+    sort.SliceStable(groups, func(i, j int) bool { return groups[i].Usernames[0] < groups[j].Usernames[0] })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(groups)
+}
+
+// API endpoint moving the results, violations, question flags and captures
+// of the student "remove" onto the student "keep", then deleting "remove".
+// It requires a "merge-students" confirmation token.
+func mergeStudentsHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    keep := r.URL.Query().Get("keep")
+    remove := r.URL.Query().Get("remove")
+    if keep == "" || remove == "" || keep == remove {
+        http.Error(w, "Two different students must be given", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if !consumeConfirmation("merge-students", r.URL.Query().Get("confirm")) {
+        http.Error(w, "Missing or invalid confirmation token", http.StatusForbidden)
+        return
+    }
+    _, keepExists := studentUser[keep]
+    _, removeExists := studentUser[remove]
+    if !keepExists || !removeExists {
+        http.Error(w, "Student not found", http.StatusNotFound)
+        return
+    }
+    if _, active := examSessions[remove]; active {
+        http.Error(w, "Student has an exam in progress", http.StatusConflict)
+        return
+    }
+
+    movedResults := 0
+    for i := range results {
+        if results[i].Username == remove {
+            results[i].Username = keep
+            movedResults++
+        }
+    }
+    movedCaptures, err := moveCaptures(remove, keep)
+    if err != nil {
+        log.Printf("merge-students: moving captures of %s: %v", remove, err)
+    }
+    movedEvents := 0
+    for i := range violationEvents {
+        if violationEvents[i].Username == remove {
+            violationEvents[i].Username = keep
+            movedEvents++
+        }
+        if path, ok := movedCaptures[violationEvents[i].ImagePath]; ok {
+            violationEvents[i].ImagePath = path
+        }
+    }
+    movedFlags := 0
+    for i := range questionFlags {
+        if questionFlags[i].Username == remove {
+            questionFlags[i].Username = keep
+            movedFlags++
+        }
+    }
+    removedCount := 0
+    for i, v := range violations {
+        if v.Username == remove {
+            removedCount = v.Count
+            violations = append(violations[:i], violations[i+1:]...)
+            break
+        }
+    }
+    if removedCount > 0 {
+        merged := false
+        for i := range violations {
+            if violations[i].Username == keep {
+                violations[i].Count += removedCount
+                merged = true
+                break
+            }
+        }
+        if !merged {
+            violations = append(violations, Violation{Username: keep, Count: removedCount})
+        }
+    }
+
+    delete(studentUser, remove)
+    delete(loginIPs, remove)
+    if path, ok := userReferenceFaces[remove]; ok {
+        os.Remove(path)
+        delete(userReferenceFaces, remove)
+    }
+    for i, s := range students {
+        if s.Username == remove {
+            students = append(students[:i], students[i+1:]...)
+            break
+        }
+    }
+    if movedResults > 0 {
+        if err := saveResults(); err != nil {
+            log.Printf("saving %s: %v", resultsFile, err)
+        }
+    }
+    if movedEvents > 0 || removedCount > 0 || len(movedCaptures) > 0 {
+        saveViolations()
+    }
+    if movedFlags > 0 {
+        if err := saveJSON(questionFlagsFile, questionFlags); err != nil {
+            log.Printf("saving %s: %v", questionFlagsFile, err)
+        }
+    }
+    recordAudit(admin, "merge-students", fmt.Sprintf("%s into %s: %d results, %d violation events, %d question flags, %d captures", remove, keep, movedResults, movedEvents, movedFlags, len(movedCaptures)))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "movedResults": movedResults, "movedViolations": movedEvents, "movedFlags": movedFlags, "movedCaptures": len(movedCaptures)})
+}
@@ -0,0 +1,914 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const examsFile = "exams.json"
+
+// Section groups an exam's questions under a heading with its own instructions.
+type Section struct {
+    Name         string
+    Instructions string
+}
+
+// Branding customises the student pages of an exam. Empty fields fall back
+// to defaultBranding.
+type Branding struct {
+    LogoURL    string
+    Title      string
+    ThemeColor string
+}
+
+var defaultBranding = Branding{
+    Title:      "Proctor Mode Exam",
+    ThemeColor: "#4CAF50",
+}
+
+var themeColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// examBranding returns exam's branding with defaults filled in. A nil exam
+// gets the defaults.
+func examBranding(exam *Exam) Branding {
+    b := defaultBranding
+    if exam == nil {
+        return b
+    }
+    if exam.Branding.LogoURL != "" {
+        b.LogoURL = exam.Branding.LogoURL
+    }
+    if exam.Branding.Title != "" {
+        b.Title = exam.Branding.Title
+    }
+    if exam.Branding.ThemeColor != "" {
+        b.ThemeColor = exam.Branding.ThemeColor
+    }
+    return b
+}
+
+// validLogoURL reports whether u is an http(s) URL or a path on this server.
+func validLogoURL(u string) bool {
+    parsed, err := url.Parse(u)
+    if err != nil {
+        return false
+    }
+    if parsed.Scheme == "" {
+        return parsed.Host == "" && strings.HasPrefix(parsed.Path, "/")
+    }
+    return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Timing modes; an empty TimingMode gives each question its own timer
+const (
+    TimingPerQuestion = "per_question"
+    TimingTimeBank    = "time_bank"
+)
+
+type Exam struct {
+    ID       int
+    Title    string
+    Sections []Section
+    // Instructions are shown before the first question.
+    Instructions string
+    // DurationMinutes is the time the exam is scheduled to take; zero if unset.
+    DurationMinutes int
+    // MinDurationMinutes is how long after starting a student must wait
+    // before submitting; zero allows submitting at any time.
+    MinDurationMinutes int
+    // IdleTimeoutMinutes overrides Config.IdleTimeoutMinutes when positive.
+    IdleTimeoutMinutes int
+    // DisabledViolations lists violation types that are ignored for this exam.
+    DisabledViolations map[string]bool
+    // TimingMode is TimingPerQuestion or TimingTimeBank. In a time bank the
+    // questions' times add up to one budget the student spends as they like.
+    TimingMode string
+    // TrackAnswerChanges keeps the history of each saved answer for review.
+    TrackAnswerChanges bool
+    // AccessCode is the hash of the code students must enter to start, or
+    // empty when no code is required. It is never listed to students.
+    AccessCode string `json:",omitempty"`
+    // RecheckMinMinutes and RecheckMaxMinutes bound the random interval
+    // between identity re-checks; a zero maximum turns them off.
+    RecheckMinMinutes int
+    RecheckMaxMinutes int
+    // Branding is shown on the exam's student pages.
+    Branding Branding
+    // CaptureInterval is how often, in seconds, the proctor page sends a
+    // frame; zero uses Config.CaptureInterval.
+    CaptureInterval int
+    // MaxViolations overrides Config.MaxViolations when positive.
+    MaxViolations int `json:",omitempty"`
+    // Leaderboard opts the exam in to /api/leaderboard, showing the top
+    // LeaderboardSize scores, with usernames hidden if LeaderboardAnonymous.
+    Leaderboard          bool
+    LeaderboardSize      int
+    LeaderboardAnonymous bool
+    // SectionSubmission has students submit each section as they finish it;
+    // submitted sections are graded and locked.
+    SectionSubmission bool
+    // LetterLabels shows multiple choice options as A, B, C... and accepts
+    // answers given by letter.
+    LetterLabels bool
+    // AutoAdvance has the server enforce each question's timer in per
+    // question timing: a question left unanswered when its time runs out is
+    // recorded as blank and the student moved on. Otherwise moving on is left
+    // to the proctor page.
+    AutoAdvance bool `json:",omitempty"`
+    // QuestionIDs picks the exam's questions from the bank, in order. An
+    // exam without any serves the whole bank.
+    QuestionIDs []int `json:",omitempty"`
+}
+
+var exams = []Exam{
+    {ID: 1, Title: "Math Exam - Grade 10"},
+    {ID: 2, Title: "Science Exam - Grade 10"},
+}
+var examIDCounter = 3
+
+// loadExams reads the persisted exams, keeping the built-in ones on first run.
+func loadExams() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    var saved []Exam
+    err := loadJSON(examsFile, &saved)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            log.Fatalf("loading %s: %v", examsFile, err)
+        }
+        return
+    }
+
+    exams = saved
+    for _, e := range exams {
+        if e.ID >= examIDCounter {
+            examIDCounter = e.ID + 1
+        }
+    }
+}
+
+// saveExams persists the exams in their listed order. Caller must hold mu.
+func saveExams() error {
+    return saveJSON(examsFile, exams)
+}
+
+// findExam returns the exam with the given ID, or nil. Caller must hold mu.
+func findExam(id int) *Exam {
+    for i := range exams {
+        if exams[i].ID == id {
+            return &exams[i]
+        }
+    }
+    return nil
+}
+
+// findQuestion returns the bank question with the given ID, or nil. Caller
+// must hold mu.
+func findQuestion(id int) *Question {
+    for i := range questions {
+        if questions[i].ID == id {
+            return &questions[i]
+        }
+    }
+    return nil
+}
+
+// captureInterval returns how many seconds apart exam's frames are sent.
+func captureInterval(cfg *Config, exam *Exam) int {
+    if exam != nil && exam.CaptureInterval > 0 {
+        return exam.CaptureInterval
+    }
+    return cfg.CaptureInterval
+}
+
+// maxViolations returns the weighted violation total at which an attempt of
+// exam is terminated.
+func maxViolations(cfg *Config, exam *Exam) int {
+    if exam != nil && exam.MaxViolations > 0 {
+        return exam.MaxViolations
+    }
+    return cfg.MaxViolations
+}
+
+// maxCaptureGap returns how long exam's sessions may go without a capture.
+// Config.MaxCaptureGap is scaled with the exam's capture interval so a slower
+// exam allows the same number of missed frames. Zero disables the check.
+func maxCaptureGap(cfg *Config, exam *Exam) time.Duration {
+    gap := time.Duration(cfg.MaxCaptureGap) * time.Second
+    return gap * time.Duration(captureInterval(cfg, exam)) / time.Duration(cfg.CaptureInterval)
+}
+
+// examIDParam parses an exam ID from the named query parameter.
+func examIDParam(r *http.Request, name string) (int, bool) {
+    id, err := strconv.Atoi(r.URL.Query().Get(name))
+    return id, err == nil
+}
+
+// examQuestions returns the questions of exam in the order they are served:
+// grouped by the exam's sections, followed by any question whose section the
+// exam does not define. An exam without sections serves its questions in
+// order. Caller must hold mu.
+func examQuestions(exam *Exam) []Question {
+    pool := assignedQuestions(exam)
+    if exam == nil || len(exam.Sections) == 0 {
+        return pool
+    }
+
+    ordered := make([]Question, 0, len(pool))
+    known := make(map[string]bool)
+    for _, section := range exam.Sections {
+        known[section.Name] = true
+        for _, q := range pool {
+            if q.Section == section.Name {
+                ordered = append(ordered, q)
+            }
+        }
+    }
+    for _, q := range pool {
+        if !known[q.Section] {
+            ordered = append(ordered, q)
+        }
+    }
+    return ordered
+}
+
+// assignedQuestions returns the bank questions listed in exam.QuestionIDs,
+// skipping any that have since been deleted, or the whole bank but for
+// ExamOnly questions when the exam lists none. Caller must hold mu.
+func assignedQuestions(exam *Exam) []Question {
+    if exam == nil || len(exam.QuestionIDs) == 0 {
+        pool := make([]Question, 0, len(questions))
+        for _, q := range questions {
+            if !q.ExamOnly {
+                pool = append(pool, q)
+            }
+        }
+        return pool
+    }
+    list := make([]Question, 0, len(exam.QuestionIDs))
+    for _, id := range exam.QuestionIDs {
+        if q := findQuestion(id); q != nil {
+            list = append(list, *q)
+        }
+    }
+    return list
+}
+
+// findSection returns the exam's section with the given name, or nil.
+func findSection(exam *Exam, name string) *Section {
+    if exam == nil {
+        return nil
+    }
+    for i := range exam.Sections {
+        if exam.Sections[i].Name == name {
+            return &exam.Sections[i]
+        }
+    }
+    return nil
+}
+
+// API endpoint to list all exams. It is public, so it only says whether each
+// exam can be started; admins get the reasons from /api/validate-exam.
+func getExamsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    type examListing struct {
+        Exam
+        RequiresAccessCode bool
+        // Startable is false while the exam is misconfigured.
+        Startable bool
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    list := make([]examListing, 0, len(exams))
+    for _, e := range exams {
+        listing := examListing{Exam: e, RequiresAccessCode: e.AccessCode != "", Startable: len(examProblems(cfg, &e)) == 0}
+        listing.AccessCode = ""
+        list = append(list, listing)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
+
+// API endpoint replacing an exam's sections
+func updateExamSectionsHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    var sections []Section
+    if err := json.NewDecoder(r.Body).Decode(&sections); err != nil {
+        http.Error(w, "Error parsing request", http.StatusBadRequest)
+        return
+    }
+
+    seen := make(map[string]bool)
+    for _, section := range sections {
+        if section.Name == "" || seen[section.Name] {
+            http.Error(w, "Section names must be unique and non-empty", http.StatusBadRequest)
+            return
+        }
+        seen[section.Name] = true
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(id)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    exam.Sections = sections
+    if err := saveExams(); err != nil {
+        log.Printf("saving %s: %v", examsFile, err)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// API endpoint updating an exam's settings. Only the fields present in the
+// form are changed.
+func examSettingsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    r.ParseForm()
+    idleTimeout, hasIdleTimeout := 0, r.PostForm.Get("idle_timeout_minutes") != ""
+    if hasIdleTimeout {
+        v, err := strconv.Atoi(r.PostForm.Get("idle_timeout_minutes"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid idle timeout", http.StatusBadRequest)
+            return
+        }
+        idleTimeout = v
+    }
+    duration, hasDuration := 0, r.PostForm.Get("duration_minutes") != ""
+    if hasDuration {
+        v, err := strconv.Atoi(r.PostForm.Get("duration_minutes"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid duration", http.StatusBadRequest)
+            return
+        }
+        duration = v
+    }
+    minDuration, hasMinDuration := 0, r.PostForm.Get("min_duration_minutes") != ""
+    if hasMinDuration {
+        v, err := strconv.Atoi(r.PostForm.Get("min_duration_minutes"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid minimum duration", http.StatusBadRequest)
+            return
+        }
+        minDuration = v
+    }
+    instructions, hasInstructions := r.PostForm.Get("instructions"), r.PostForm.Has("instructions")
+    trackChanges, hasTrackChanges := false, r.PostForm.Get("track_answer_changes") != ""
+    if hasTrackChanges {
+        v, err := strconv.ParseBool(r.PostForm.Get("track_answer_changes"))
+        if err != nil {
+            http.Error(w, "Invalid track_answer_changes value", http.StatusBadRequest)
+            return
+        }
+        trackChanges = v
+    }
+    interval, hasInterval := 0, r.PostForm.Get("capture_interval") != ""
+    if hasInterval {
+        v, err := strconv.Atoi(r.PostForm.Get("capture_interval"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid capture interval", http.StatusBadRequest)
+            return
+        }
+        interval = v
+    }
+    maxViolationsSetting, hasMaxViolations := 0, r.PostForm.Get("max_violations") != ""
+    if hasMaxViolations {
+        v, err := strconv.Atoi(r.PostForm.Get("max_violations"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid max violations", http.StatusBadRequest)
+            return
+        }
+        maxViolationsSetting = v
+    }
+    leaderboard, hasLeaderboard := false, r.PostForm.Get("leaderboard") != ""
+    if hasLeaderboard {
+        v, err := strconv.ParseBool(r.PostForm.Get("leaderboard"))
+        if err != nil {
+            http.Error(w, "Invalid leaderboard value", http.StatusBadRequest)
+            return
+        }
+        leaderboard = v
+    }
+    leaderboardAnonymous, hasLeaderboardAnonymous := false, r.PostForm.Get("leaderboard_anonymous") != ""
+    if hasLeaderboardAnonymous {
+        v, err := strconv.ParseBool(r.PostForm.Get("leaderboard_anonymous"))
+        if err != nil {
+            http.Error(w, "Invalid leaderboard_anonymous value", http.StatusBadRequest)
+            return
+        }
+        leaderboardAnonymous = v
+    }
+    sectionSubmission, hasSectionSubmission := false, r.PostForm.Get("section_submission") != ""
+    if hasSectionSubmission {
+        v, err := strconv.ParseBool(r.PostForm.Get("section_submission"))
+        if err != nil {
+            http.Error(w, "Invalid section_submission value", http.StatusBadRequest)
+            return
+        }
+        sectionSubmission = v
+    }
+    letterLabels, hasLetterLabels := false, r.PostForm.Get("letter_labels") != ""
+    if hasLetterLabels {
+        v, err := strconv.ParseBool(r.PostForm.Get("letter_labels"))
+        if err != nil {
+            http.Error(w, "Invalid letter_labels value", http.StatusBadRequest)
+            return
+        }
+        letterLabels = v
+    }
+    autoAdvance, hasAutoAdvance := false, r.PostForm.Get("auto_advance") != ""
+    if hasAutoAdvance {
+        v, err := strconv.ParseBool(r.PostForm.Get("auto_advance"))
+        if err != nil {
+            http.Error(w, "Invalid auto_advance value", http.StatusBadRequest)
+            return
+        }
+        autoAdvance = v
+    }
+    leaderboardSize, hasLeaderboardSize := 0, r.PostForm.Get("leaderboard_size") != ""
+    if hasLeaderboardSize {
+        v, err := strconv.Atoi(r.PostForm.Get("leaderboard_size"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid leaderboard size", http.StatusBadRequest)
+            return
+        }
+        leaderboardSize = v
+    }
+    recheckMin, hasRecheckMin := 0, r.PostForm.Get("recheck_min_minutes") != ""
+    if hasRecheckMin {
+        v, err := strconv.Atoi(r.PostForm.Get("recheck_min_minutes"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid recheck interval", http.StatusBadRequest)
+            return
+        }
+        recheckMin = v
+    }
+    recheckMax, hasRecheckMax := 0, r.PostForm.Get("recheck_max_minutes") != ""
+    if hasRecheckMax {
+        v, err := strconv.Atoi(r.PostForm.Get("recheck_max_minutes"))
+        if err != nil || v < 0 {
+            http.Error(w, "Invalid recheck interval", http.StatusBadRequest)
+            return
+        }
+        recheckMax = v
+    }
+    logoURL, hasLogoURL := r.PostForm.Get("logo_url"), r.PostForm.Has("logo_url")
+    if hasLogoURL && logoURL != "" && !validLogoURL(logoURL) {
+        http.Error(w, "Invalid logo URL", http.StatusBadRequest)
+        return
+    }
+    brandTitle, hasBrandTitle := r.PostForm.Get("brand_title"), r.PostForm.Has("brand_title")
+    themeColor, hasThemeColor := r.PostForm.Get("theme_color"), r.PostForm.Has("theme_color")
+    if hasThemeColor && themeColor != "" && !themeColorPattern.MatchString(themeColor) {
+        http.Error(w, "Invalid theme color", http.StatusBadRequest)
+        return
+    }
+    timingMode, hasTimingMode := r.PostForm.Get("timing_mode"), r.PostForm.Has("timing_mode")
+    if hasTimingMode && timingMode != "" && timingMode != TimingPerQuestion && timingMode != TimingTimeBank {
+        http.Error(w, "Invalid timing mode", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(id)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    // The recheck range is checked against the exam's current bounds before
+    // anything changes, so a rejected request leaves the exam as it was.
+    if hasRecheckMin || hasRecheckMax {
+        if !hasRecheckMin {
+            recheckMin = exam.RecheckMinMinutes
+        }
+        if !hasRecheckMax {
+            recheckMax = exam.RecheckMaxMinutes
+        }
+        if recheckMax > 0 && recheckMin > recheckMax {
+            http.Error(w, "Recheck minimum exceeds maximum", http.StatusBadRequest)
+            return
+        }
+    }
+    if hasIdleTimeout {
+        exam.IdleTimeoutMinutes = idleTimeout
+    }
+    if hasTimingMode {
+        exam.TimingMode = timingMode
+    }
+    if hasInstructions {
+        exam.Instructions = instructions
+    }
+    if hasTrackChanges {
+        exam.TrackAnswerChanges = trackChanges
+    }
+    if hasDuration {
+        exam.DurationMinutes = duration
+    }
+    if hasMinDuration {
+        exam.MinDurationMinutes = minDuration
+    }
+    if hasRecheckMin || hasRecheckMax {
+        exam.RecheckMinMinutes, exam.RecheckMaxMinutes = recheckMin, recheckMax
+    }
+    if hasInterval {
+        exam.CaptureInterval = interval
+    }
+    if hasMaxViolations {
+        exam.MaxViolations = maxViolationsSetting
+    }
+    if hasSectionSubmission {
+        exam.SectionSubmission = sectionSubmission
+    }
+    if hasLetterLabels {
+        exam.LetterLabels = letterLabels
+    }
+    if hasAutoAdvance {
+        exam.AutoAdvance = autoAdvance
+    }
+    if hasLeaderboard {
+        exam.Leaderboard = leaderboard
+    }
+    if hasLeaderboardAnonymous {
+        exam.LeaderboardAnonymous = leaderboardAnonymous
+    }
+    if hasLeaderboardSize {
+        exam.LeaderboardSize = leaderboardSize
+    }
+    changedLeaderboard := hasLeaderboard || hasLeaderboardAnonymous || hasLeaderboardSize
+    if hasLogoURL {
+        exam.Branding.LogoURL = logoURL
+    }
+    if hasBrandTitle {
+        exam.Branding.Title = brandTitle
+    }
+    if hasThemeColor {
+        exam.Branding.ThemeColor = themeColor
+    }
+    changedBranding := hasLogoURL || hasBrandTitle || hasThemeColor
+    if hasIdleTimeout || hasTimingMode || hasInstructions || hasTrackChanges || hasDuration || hasMinDuration || hasRecheckMin || hasRecheckMax || hasInterval || changedBranding || changedLeaderboard || hasSectionSubmission || hasLetterLabels || hasAutoAdvance || hasMaxViolations {
+        if err := saveExams(); err != nil {
+            log.Printf("saving %s: %v", examsFile, err)
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(exam)
+}
+
+// API endpoint rearranging the exam list. The body is every exam ID in the
+// new order.
+func reorderExamsHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    var ids []int
+    if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+        http.Error(w, "Error parsing request", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if len(ids) != len(exams) {
+        http.Error(w, "Order must list every exam exactly once", http.StatusBadRequest)
+        return
+    }
+    reordered := make([]Exam, 0, len(exams))
+    seen := make(map[int]bool)
+    for _, id := range ids {
+        exam := findExam(id)
+        if exam == nil || seen[id] {
+            http.Error(w, "Order must list every exam exactly once", http.StatusBadRequest)
+            return
+        }
+        seen[id] = true
+        reordered = append(reordered, *exam)
+    }
+
+    previous := exams
+    exams = reordered
+    if err := saveExams(); err != nil {
+        exams = previous
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving exams"})
+        return
+    }
+    recordAudit(admin, "reorder-exams", "")
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(exams)
+}
+
+// API endpoint copying an exam, its settings and its questions under new IDs.
+// Each question is duplicated in the bank, audio included, so editing or
+// deleting a question of one exam never changes the other. The copies are
+// ExamOnly, so exams serving the whole bank don't serve them twice.
+func cloneExamHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    id, ok := examIDParam(r, "id")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    original := findExam(id)
+    if original == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    clone := *original
+    clone.ID = examIDCounter
+    clone.Title = original.Title + " (copy)"
+    clone.Sections = append([]Section(nil), original.Sections...)
+    if original.DisabledViolations != nil {
+        clone.DisabledViolations = make(map[string]bool, len(original.DisabledViolations))
+        for violationType, disabled := range original.DisabledViolations {
+            clone.DisabledViolations[violationType] = disabled
+        }
+    }
+
+    var copies []Question
+    for _, q := range assignedQuestions(original) {
+        c, err := copyQuestion(q, questionIDCounter+len(copies))
+        if err != nil {
+            removeQuestionAudio(copies)
+            log.Printf("clone-exam: copying question %d: %v", q.ID, err)
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error copying question audio"})
+            return
+        }
+        copies = append(copies, c)
+    }
+    clone.QuestionIDs = questionIDs(copies)
+
+    exams = append(exams, clone)
+    if err := saveExams(); err != nil {
+        exams = exams[:len(exams)-1]
+        removeQuestionAudio(copies)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving exams"})
+        return
+    }
+    examIDCounter++
+    questions = append(questions, copies...)
+    questionIDCounter += len(copies)
+    saveQuestions()
+    recordAudit(admin, "clone-exam", fmt.Sprintf("%d as %d with %d questions", id, clone.ID, len(copies)))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": clone.ID})
+}
+
+// copyQuestion returns a deep copy of q under id, with its own copy of any
+// audio clip.
+func copyQuestion(q Question, id int) (Question, error) {
+    c := q
+    c.ID = id
+    c.ExamOnly = true
+    c.Options = append([]string(nil), q.Options...)
+    c.Matches = append([]string(nil), q.Matches...)
+    if q.Translations != nil {
+        c.Translations = make(map[string]QuestionText, len(q.Translations))
+        for lang, t := range q.Translations {
+            t.Options = append([]string(nil), t.Options...)
+            c.Translations[lang] = t
+        }
+    }
+    if q.AudioPath != "" {
+        audio, err := ioutil.ReadFile(q.AudioPath)
+        if err != nil {
+            return Question{}, err
+        }
+        if c.AudioPath, err = saveQuestionAudio(id, audio, filepath.Ext(q.AudioPath)); err != nil {
+            return Question{}, err
+        }
+    }
+    return c, nil
+}
+
+// removeQuestionAudio deletes the audio files of qs, undoing copies that
+// were never added to the bank.
+func removeQuestionAudio(qs []Question) {
+    for _, q := range qs {
+        if q.AudioPath != "" {
+            os.Remove(q.AudioPath)
+        }
+    }
+}
+
+// API endpoint attaching bank questions to an exam. The body is a list of
+// question IDs, added to the exam's questions or, with mode=replace,
+// replacing them. Nothing changes if any ID is unknown.
+func assignQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    replace := r.URL.Query().Get("mode") == "replace"
+
+    var ids []int
+    if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+        http.Error(w, "Error parsing request", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(id)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    invalid := []int{}
+    for _, qid := range ids {
+        if findQuestion(qid) == nil {
+            invalid = append(invalid, qid)
+        }
+    }
+    if len(invalid) > 0 {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Unknown question IDs", "invalid": invalid})
+        return
+    }
+
+    previous := exam.QuestionIDs
+    var assigned []int
+    if !replace {
+        assigned = append(assigned, previous...)
+    }
+    seen := make(map[int]bool, len(assigned)+len(ids))
+    for _, qid := range assigned {
+        seen[qid] = true
+    }
+    for _, qid := range ids {
+        if !seen[qid] {
+            seen[qid] = true
+            assigned = append(assigned, qid)
+        }
+    }
+    exam.QuestionIDs = assigned
+    if err := saveExams(); err != nil {
+        exam.QuestionIDs = previous
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving exams"})
+        return
+    }
+    recordAudit(admin, "assign-questions", fmt.Sprintf("exam %d: %d questions", id, len(assigned)))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "questionIDs": assigned})
+}
+
+// API endpoint setting the code students must enter to start an exam. An
+// empty code removes the requirement.
+func examAccessCodeHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    code := strings.TrimSpace(r.FormValue("code"))
+    hash := ""
+    if code != "" {
+        hash = hashPassword(code)
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(id)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    previous := exam.AccessCode
+    exam.AccessCode = hash
+    if err := saveExams(); err != nil {
+        exam.AccessCode = previous
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving exams"})
+        return
+    }
+    if hash == "" {
+        recordAudit(admin, "clear-access-code", fmt.Sprintf("exam %d", id))
+    } else {
+        recordAudit(admin, "set-access-code", fmt.Sprintf("exam %d", id))
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// API endpoint summarising an exam's question count and timing, with
+// warnings when the question times don't fit the exam's duration
+func examSummaryHandler(w http.ResponseWriter, r *http.Request) {
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(id)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    examQs := examQuestions(exam)
+    questionSeconds := 0
+    perSection := make(map[string]int)
+    for _, q := range examQs {
+        questionSeconds += q.Time
+        perSection[q.Section]++
+    }
+    durationSeconds := exam.DurationMinutes * 60
+
+    warnings := []string{}
+    if len(examQs) == 0 {
+        warnings = append(warnings, "exam has no questions")
+    }
+    if durationSeconds == 0 {
+        warnings = append(warnings, "exam has no duration set")
+    } else if questionSeconds > durationSeconds {
+        warnings = append(warnings, fmt.Sprintf("question times add up to %ds, more than the %ds duration", questionSeconds, durationSeconds))
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "examId":             exam.ID,
+        "title":              exam.Title,
+        "timingMode":         exam.TimingMode,
+        "totalQuestions":     len(examQs),
+        "questionsBySection": perSection,
+        "questionSeconds":    questionSeconds,
+        "durationSeconds":    durationSeconds,
+        "fits":               durationSeconds == 0 || questionSeconds <= durationSeconds,
+        "warnings":           warnings,
+    })
+}
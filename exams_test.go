@@ -0,0 +1,70 @@
+package main
+
+import (
+    "encoding/json"
+    "net/url"
+    "testing"
+)
+
+func TestCloneExamKeepsSharedPool(t *testing.T) {
+    resetState(t, 3)
+    mu.Lock()
+    exams = []Exam{{ID: 1, Title: "Maths"}, {ID: 2, Title: "Science"}}
+    examIDCounter = 3
+    mu.Unlock()
+
+    w := serve(cloneExamHandler, "/clone-exam?id=1", url.Values{})
+    var resp struct {
+        Success bool
+        ID      int
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || !resp.Success {
+        t.Fatalf("cloning: %d %s", w.Code, w.Body.String())
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if len(questions) != 6 {
+        t.Fatalf("bank has %d questions, want 6", len(questions))
+    }
+    for _, tt := range []struct {
+        name string
+        exam *Exam
+        ids  []int
+    }{
+        {"original", findExam(1), []int{1, 2, 3}},
+        {"other exam", findExam(2), []int{1, 2, 3}},
+        {"no exam", nil, []int{1, 2, 3}},
+        {"clone", findExam(resp.ID), []int{4, 5, 6}},
+    } {
+        got := questionIDs(examQuestions(tt.exam))
+        if len(got) != len(tt.ids) {
+            t.Errorf("%s serves %v, want %v", tt.name, got, tt.ids)
+            continue
+        }
+        for i := range got {
+            if got[i] != tt.ids[i] {
+                t.Errorf("%s serves %v, want %v", tt.name, got, tt.ids)
+                break
+            }
+        }
+    }
+}
+
+func TestExamSettingsRejectedLeavesExam(t *testing.T) {
+    resetState(t, 0)
+    w := serve(withConfig(testConfig, examSettingsHandler), "/exam-settings?exam=1", url.Values{
+        "instructions":         {"NEW"},
+        "idle_timeout_minutes": {"7"},
+        "recheck_min_minutes":  {"10"},
+        "recheck_max_minutes":  {"5"},
+    })
+    if w.Code != 400 {
+        t.Fatalf("got %d %s, want 400", w.Code, w.Body.String())
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if e := findExam(1); e.Instructions != "" || e.IdleTimeoutMinutes != 0 || e.RecheckMinMinutes != 0 {
+        t.Errorf("rejected settings were applied: %+v", *e)
+    }
+}
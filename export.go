@@ -0,0 +1,119 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// API endpoint exporting violation events as CSV, optionally filtered to one
+// student and/or exam. Simulated events are left out.
+func exportViolationsHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    username := r.URL.Query().Get("user")
+    examID := 0
+    if r.URL.Query().Get("exam") != "" {
+        id, ok := examIDParam(r, "exam")
+        if !ok {
+            http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+            return
+        }
+        examID = id
+    }
+
+    mu.Lock()
+    var events []ViolationEvent
+    for _, e := range violationEvents {
+        if (username == "" || e.Username == username) && (examID == 0 || e.ExamID == examID) && !e.Simulated {
+            events = append(events, e)
+        }
+    }
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "text/csv")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"violations-%s.csv\"", time.Now().Format("20060102-150405")))
+
+    cw := csv.NewWriter(w)
+    cw.Write([]string{"id", "username", "exam_id", "type", "detail", "weight", "time", "duration_seconds"})
+    for _, e := range events {
+        cw.Write([]string{
+            strconv.Itoa(e.ID),
+            e.Username,
+            strconv.Itoa(e.ExamID),
+            e.Type,
+            e.Detail,
+            strconv.Itoa(e.Weight),
+            e.Time.Format(time.RFC3339),
+            exportDuration(e.Duration),
+        })
+    }
+    cw.Flush()
+}
+
+// exportDuration formats a focus loss duration in seconds, or empty when
+// none was reported.
+func exportDuration(d time.Duration) string {
+    if d == 0 {
+        return ""
+    }
+    return strconv.FormatFloat(d.Seconds(), 'f', 1, 64)
+}
+
+// API endpoint exporting an exam's questions without their answers, for
+// sitting it on paper when the digital exam can't run. Questions go through
+// the same serialization students are served, so no answer can leak. The
+// default is JSON; ?format=html gives a printable sheet.
+func exportBlankHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    format := r.URL.Query().Get("format")
+    if format != "" && format != "json" && format != "html" {
+        http.Error(w, "Unsupported format", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    exam := findExam(examID)
+    if exam == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    title := exam.Title
+    sheet := []StudentQuestion{}
+    for i, q := range examQuestions(exam) {
+        sq := newStudentQuestion(q, "", 0)
+        sq.Index = i
+        if i == 0 || q.Section != sheet[i-1].Section {
+            sq.SectionStart = findSection(exam, q.Section)
+        }
+        sheet = append(sheet, sq)
+    }
+    mu.Unlock()
+
+    if format == "html" {
+        data := struct {
+            Title     string
+            Questions []StudentQuestion
+        }{title, sheet}
+        templates.ExecuteTemplate(w, "blank_sheet.html", data)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"exam-%d-blank.json\"", examID))
+    json.NewEncoder(w).Encode(map[string]interface{}{"exam": examID, "title": title, "questions": sheet})
+}
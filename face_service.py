@@ -353,6 +353,29 @@ def validate_face():
         # Just check if a face is detected
         return "FACE_DETECTED"
 
+@app.route("/count-faces", methods=["POST"])
+def count_faces():
+    img_data = request.form.get("image")
+    if not img_data:
+        return "ERROR", 400
+
+    curr_path = save_image_from_base64(img_data)
+    image = cv2.imread(curr_path)
+    if image is None:
+        return "ERROR", 400
+
+    with mp_face_mesh.FaceMesh(
+        max_num_faces=5,
+        refine_landmarks=True,
+        min_detection_confidence=0.5,
+        min_tracking_confidence=0.5
+    ) as face_mesh:
+        rgb_image = cv2.cvtColor(image, cv2.COLOR_BGR2RGB)
+        results = face_mesh.process(rgb_image)
+        count = len(results.multi_face_landmarks) if results.multi_face_landmarks else 0
+
+    return f"FACES:{count}"
+
 @app.route("/capture", methods=["POST"])
 def capture():
     img_data = request.form.get("image")
@@ -0,0 +1,122 @@
+package main
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "path"
+    "strings"
+)
+
+// Upload limits for /import-faces
+const (
+    maxFaceArchiveBytes = 200 << 20
+    maxFaceImageBytes   = 10 << 20
+)
+
+// FaceImportResult reports what happened to one file of a face import.
+type FaceImportResult struct {
+    File     string `json:"file"`
+    Username string `json:"username,omitempty"`
+    Success  bool   `json:"success"`
+    Replaced bool   `json:"replaced,omitempty"` // An earlier reference face was overwritten
+    Message  string `json:"message,omitempty"`
+}
+
+// API endpoint enrolling reference faces in bulk. The body is a zip whose
+// entries are named <username>.jpg, each for an existing student. Every
+// image gets the same one-face check as a single upload; files that fail it
+// or name unknown students are reported and skipped.
+func importFacesHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxFaceArchiveBytes))
+    if err != nil {
+        http.Error(w, "Error reading request; the archive may be too large", http.StatusBadRequest)
+        return
+    }
+    archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+    if err != nil {
+        http.Error(w, "The body is not a zip archive", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    report := []FaceImportResult{}
+    imported := 0
+    for _, file := range archive.File {
+        name := path.Base(file.Name)
+        if file.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(file.Name, "__MACOSX/") {
+            continue
+        }
+        result := importFace(cfg, file, name)
+        if result.Success {
+            imported++
+        }
+        report = append(report, result)
+    }
+
+    mu.Lock()
+    recordAudit(admin, "import-faces", fmt.Sprintf("%d imported, %d skipped", imported, len(report)-imported))
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "imported": imported, "files": report})
+}
+
+// importFace checks and stores one archive entry as the reference face of
+// the student it is named after.
+func importFace(cfg *Config, file *zip.File, name string) FaceImportResult {
+    result := FaceImportResult{File: file.Name}
+    ext := strings.ToLower(path.Ext(name))
+    if ext != ".jpg" && ext != ".jpeg" {
+        result.Message = "Not a .jpg file"
+        return result
+    }
+    username := strings.TrimSuffix(name, path.Ext(name))
+    result.Username = username
+
+    mu.Lock()
+    _, known := studentUser[username]
+    _, replaced := userReferenceFaces[username]
+    mu.Unlock()
+    if !known || !validPathName(username) {
+        result.Message = "Unknown student"
+        return result
+    }
+    if file.UncompressedSize64 > maxFaceImageBytes {
+        result.Message = "Image too large"
+        return result
+    }
+
+    rc, err := file.Open()
+    if err != nil {
+        result.Message = "Error reading image"
+        return result
+    }
+    data, err := ioutil.ReadAll(io.LimitReader(rc, maxFaceImageBytes))
+    rc.Close()
+    if err != nil {
+        result.Message = "Error reading image"
+        return result
+    }
+
+    faceImage := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)
+    if message := referenceFaceProblem(cfg, faceImage); message != "" {
+        result.Message = message
+        return result
+    }
+    if err := saveReferenceFace(username, faceImage); err != nil {
+        result.Message = err.Error()
+        return result
+    }
+    result.Success, result.Replaced = true, replaced
+    return result
+}
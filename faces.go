@@ -0,0 +1,228 @@
+package main
+
+import (
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// faceSlots holds a token for every call in flight to the face service, so
+// at most Config.FaceServiceConcurrency run at once. It is sized at startup.
+var faceSlots chan struct{}
+
+// faceServiceRejected counts calls turned away because no slot freed up.
+var faceServiceRejected int64
+
+// errFaceServiceBusy is returned when every slot stayed taken for the whole
+// queue wait.
+var errFaceServiceBusy = errors.New("face service busy")
+
+// faceServiceUnknown counts face service responses no handler recognized.
+var faceServiceUnknown int64
+
+// errFaceServiceUnknown stands for a face service response no handler
+// recognizes, e.g. after the service changed.
+var errFaceServiceUnknown = errors.New("unknown face service response")
+
+// errFaceServiceDown is returned without calling the face service while the
+// breaker is open.
+var errFaceServiceDown = errors.New("face service unavailable")
+
+// faceClient bounds how long a face service call may take. It is set up at
+// startup from Config.FaceServiceTimeoutSeconds.
+var faceClient = http.DefaultClient
+
+// Face service breaker states
+const (
+    BreakerClosed   = "closed"    // Calls go through
+    BreakerOpen     = "open"      // Calls fail at once until the next probe
+    BreakerHalfOpen = "half_open" // One probe call is deciding whether to close
+)
+
+// faceBreaker stops calling the face service after
+// Config.FaceServiceFailureThreshold failures in a row, so an outage doesn't
+// tie up every request in timeouts. Once Config.FaceServiceProbeSeconds have
+// passed, one call is let through as a probe; its success closes the
+// breaker again.
+var faceBreaker struct {
+    sync.Mutex
+    State    string
+    Failures int // Consecutive failures
+    OpenedAt time.Time
+    Opened   int // Times the breaker has opened
+}
+
+func init() {
+    faceBreaker.State = BreakerClosed
+}
+
+// breakerAllow reports whether a face service call may go ahead.
+func breakerAllow(cfg *Config) bool {
+    faceBreaker.Lock()
+    defer faceBreaker.Unlock()
+
+    switch faceBreaker.State {
+    case BreakerOpen:
+        if time.Since(faceBreaker.OpenedAt) < time.Duration(cfg.FaceServiceProbeSeconds)*time.Second {
+            return false
+        }
+        faceBreaker.State = BreakerHalfOpen
+        return true
+    case BreakerHalfOpen:
+        return false // A probe is already in flight
+    }
+    return true
+}
+
+// breakerRecord updates the breaker with the outcome of a call.
+func breakerRecord(cfg *Config, failed bool) {
+    faceBreaker.Lock()
+    defer faceBreaker.Unlock()
+
+    if !failed {
+        if faceBreaker.State != BreakerClosed {
+            log.Printf("face service recovered; breaker closed")
+        }
+        faceBreaker.State = BreakerClosed
+        faceBreaker.Failures = 0
+        return
+    }
+    faceBreaker.Failures++
+    if faceBreaker.State == BreakerHalfOpen || faceBreaker.Failures >= cfg.FaceServiceFailureThreshold {
+        if faceBreaker.State != BreakerOpen {
+            log.Printf("face service failing (%d in a row); breaker open", faceBreaker.Failures)
+            faceBreaker.Opened++
+        }
+        faceBreaker.State = BreakerOpen
+        faceBreaker.OpenedAt = time.Now()
+    }
+}
+
+// postFaceService posts form to path on the face service and returns the
+// response body. It waits up to Config.FaceServiceQueueMillis for a free
+// slot before giving up with errFaceServiceBusy, and fails with
+// errFaceServiceDown while the breaker is open.
+func postFaceService(cfg *Config, path string, form url.Values) (string, error) {
+    if !breakerAllow(cfg) {
+        return "", errFaceServiceDown
+    }
+
+    select {
+    case faceSlots <- struct{}{}:
+    default:
+        wait := time.NewTimer(time.Duration(cfg.FaceServiceQueueMillis) * time.Millisecond)
+        select {
+        case faceSlots <- struct{}{}:
+            wait.Stop()
+        case <-wait.C:
+            atomic.AddInt64(&faceServiceRejected, 1)
+            breakerRelease()
+            return "", errFaceServiceBusy
+        }
+    }
+    defer func() { <-faceSlots }()
+
+    resp, err := faceClient.PostForm(cfg.FaceServiceURL+path, form)
+    if err != nil {
+        breakerRecord(cfg, true)
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    body, err := ioutil.ReadAll(resp.Body)
+    breakerRecord(cfg, err != nil || resp.StatusCode >= 500)
+    return string(body), err
+}
+
+// breakerRelease gives up a probe that never reached the face service, so
+// the next call can probe instead.
+func breakerRelease() {
+    faceBreaker.Lock()
+    defer faceBreaker.Unlock()
+
+    if faceBreaker.State == BreakerHalfOpen {
+        faceBreaker.State = BreakerOpen
+        faceBreaker.OpenedAt = time.Time{}
+    }
+}
+
+// faceServiceError answers a request whose face service call failed with err.
+func faceServiceError(cfg *Config, w http.ResponseWriter, err error) {
+    switch err {
+    case errFaceServiceBusy:
+        w.Header().Set("Retry-After", "1")
+        w.WriteHeader(http.StatusServiceUnavailable)
+        w.Write([]byte("TRY_AGAIN"))
+    case errFaceServiceDown:
+        w.Header().Set("Retry-After", strconv.Itoa(cfg.FaceServiceProbeSeconds))
+        w.WriteHeader(http.StatusServiceUnavailable)
+        w.Write([]byte("SERVICE_UNAVAILABLE"))
+    case errFaceServiceUnknown:
+        w.WriteHeader(http.StatusBadGateway)
+        w.Write([]byte("UNKNOWN_RESPONSE"))
+    default:
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte("ERROR"))
+    }
+}
+
+// unknownFaceResponse logs a response from path on the face service that
+// isn't one of the expected ones and reports whether to carry on as though
+// the check had failed, per Config.FaceServiceSoftFail. Otherwise the caller
+// answers with faceServiceError(cfg, w, errFaceServiceUnknown).
+func unknownFaceResponse(cfg *Config, path, body string) bool {
+    atomic.AddInt64(&faceServiceUnknown, 1)
+    if len(body) > 200 {
+        body = body[:200] + "..."
+    }
+    log.Printf("unknown face service response from %s: %q", path, body)
+    return cfg.FaceServiceSoftFail
+}
+
+// countFaces asks the face service how many faces are in a base64 image.
+func countFaces(cfg *Config, imgData string) (int, error) {
+    body, err := postFaceService(cfg, "/count-faces", url.Values{
+        "image": {imgData},
+    })
+    if err != nil {
+        return 0, err
+    }
+
+    countStr := strings.TrimPrefix(body, "FACES:")
+    if countStr == body {
+        return 0, fmt.Errorf("unexpected face service response %q", body)
+    }
+    return strconv.Atoi(countStr)
+}
+
+// referenceFacesMatch asks the face service whether the reference faces at
+// pathA and pathB show the same person.
+func referenceFacesMatch(cfg *Config, pathA, pathB string) (bool, error) {
+    data, err := ioutil.ReadFile(pathA)
+    if err != nil {
+        return false, err
+    }
+    body, err := postFaceService(cfg, "/validate-face", url.Values{
+        "image":          {"data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)},
+        "reference_face": {pathB},
+    })
+    if err != nil {
+        return false, err
+    }
+    switch body {
+    case "FACE_MATCH":
+        return true, nil
+    case "NO_FACE_MATCH", "NO_FACE_DETECTED":
+        return false, nil
+    }
+    return false, fmt.Errorf("unexpected face service response %q", body)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+    "time"
+)
+
+// fakeFaceService points the face service at a server answering every call
+// with body as contentType, and restores the real settings when t ends.
+func fakeFaceService(t *testing.T, contentType, body string, softFail bool) {
+    t.Helper()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", contentType)
+        w.Write([]byte(body))
+    }))
+    oldURL, oldSoftFail, oldClient, oldSlots := testConfig.FaceServiceURL, testConfig.FaceServiceSoftFail, faceClient, faceSlots
+    t.Cleanup(func() {
+        srv.Close()
+        testConfig.FaceServiceURL, testConfig.FaceServiceSoftFail, faceClient, faceSlots = oldURL, oldSoftFail, oldClient, oldSlots
+    })
+    testConfig.FaceServiceURL = srv.URL
+    testConfig.FaceServiceSoftFail = softFail
+    faceClient = srv.Client()
+    faceSlots = make(chan struct{}, 1)
+
+    mu.Lock()
+    userReferenceFaces = map[string]string{"alice": "reference_faces/alice.png"}
+    lastCaptureAccepted = make(map[string]time.Time)
+    mu.Unlock()
+}
+
+func TestUnexpectedFaceServiceResponses(t *testing.T) {
+    bodies := []struct {
+        name        string
+        contentType string
+        body        string
+    }{
+        {"empty body", "text/plain", ""},
+        {"bad JSON", "application/json", `{"status": "FACE_MA`},
+        {"JSON instead of text", "application/json", `{"status": "FACE_MATCH"}`},
+        {"wrong content type", "text/html", "<html><body>502 Bad Gateway</body></html>"},
+        {"lower case", "text/plain", "face_match"},
+    }
+    endpoints := []struct {
+        name     string
+        handler  http.HandlerFunc
+        form     url.Values
+        softFail string // What a soft failure answers with
+    }{
+        {"capture", withConfig(testConfig, captureHandler), url.Values{"image": {"data:image/png;base64,AA=="}, "username": {"alice"}}, "OK"},
+        {"validate against reference", withConfig(testConfig, validateFaceHandler), url.Values{"image": {"data:image/png;base64,AA=="}, "username": {"alice"}}, "NO_FACE_MATCH"},
+        {"detect", withConfig(testConfig, validateFaceHandler), url.Values{"image": {"data:image/png;base64,AA=="}}, "NO_FACE_DETECTED"},
+    }
+
+    for _, e := range endpoints {
+        for _, b := range bodies {
+            resetState(t, 0)
+            fakeFaceService(t, b.contentType, b.body, false)
+            w := serve(e.handler, "/", e.form)
+            if w.Code != http.StatusBadGateway || w.Body.String() != "UNKNOWN_RESPONSE" {
+                t.Errorf("%s, %s: got %d %q, want 502 UNKNOWN_RESPONSE", e.name, b.name, w.Code, w.Body.String())
+            }
+
+            fakeFaceService(t, b.contentType, b.body, true)
+            w = serve(e.handler, "/", e.form)
+            if w.Code != http.StatusOK || w.Body.String() != e.softFail {
+                t.Errorf("%s, %s with soft failure: got %d %q, want 200 %s", e.name, b.name, w.Code, w.Body.String(), e.softFail)
+            }
+        }
+    }
+}
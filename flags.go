@@ -0,0 +1,125 @@
+package main
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const questionFlagsFile = "question_flags.json"
+
+// QuestionFlag is a student's report that a question looks wrong.
+type QuestionFlag struct {
+    QuestionID int
+    ExamID     int
+    Username   string
+    Comment    string
+    Time       time.Time
+}
+
+var questionFlags []QuestionFlag
+
+// loadQuestionFlags reads the persisted question flags.
+func loadQuestionFlags() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    if err := loadJSON(questionFlagsFile, &questionFlags); err != nil && !os.IsNotExist(err) {
+        log.Fatalf("loading %s: %v", questionFlagsFile, err)
+    }
+}
+
+// API endpoint letting a student flag the question served at index during
+// their exam. Flags never affect grading.
+func flagQuestionHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+    index, err := strconv.Atoi(r.FormValue("index"))
+    if err != nil || index < 0 {
+        http.Error(w, "Invalid question index", http.StatusBadRequest)
+        return
+    }
+    comment := strings.TrimSpace(r.FormValue("comment"))
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok || session.Terminated {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    q, served := servedQuestion(session, index)
+    if index >= userQuestionIndex[username] || !served {
+        http.Error(w, "Question has not been served", http.StatusBadRequest)
+        return
+    }
+
+    questionFlags = append(questionFlags, QuestionFlag{
+        QuestionID: q.ID,
+        ExamID:     session.ExamID,
+        Username:   username,
+        Comment:    comment,
+        Time:       time.Now(),
+    })
+    if err := saveJSON(questionFlagsFile, questionFlags); err != nil {
+        questionFlags = questionFlags[:len(questionFlags)-1]
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving flag"})
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// API endpoint listing flagged questions, most flagged first
+func questionFlagsHandler(w http.ResponseWriter, r *http.Request) {
+    type flaggedQuestion struct {
+        QuestionID int
+        Text       string
+        Count      int
+        Flags      []QuestionFlag
+    }
+
+    mu.Lock()
+    byQuestion := make(map[int]*flaggedQuestion)
+    for _, f := range questionFlags {
+        fq, ok := byQuestion[f.QuestionID]
+        if !ok {
+            fq = &flaggedQuestion{QuestionID: f.QuestionID}
+            for _, q := range questions {
+                if q.ID == f.QuestionID {
+                    fq.Text = q.Text
+                    break
+                }
+            }
+            byQuestion[f.QuestionID] = fq
+        }
+        fq.Count++
+        fq.Flags = append(fq.Flags, f)
+    }
+    mu.Unlock()
+
+    list := make([]flaggedQuestion, 0, len(byQuestion))
+    for _, fq := range byQuestion {
+        list = append(list, *fq)
+    }
+    sort.Slice(list, func(i, j int) bool {
+        if list[i].Count != list[j].Count {
+            return list[i].Count > list[j].Count
+        }
+        return list[i].QuestionID < list[j].QuestionID
+    })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
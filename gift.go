@@ -0,0 +1,259 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// GIFTProblem is a question in an import that could not be converted.
+type GIFTProblem struct {
+    Line    int // Line the question starts on
+    Text    string
+    Problem string
+}
+
+// giftUnescape replaces GIFT's backslash escapes with the characters they
+// stand for.
+var giftUnescape = strings.NewReplacer(`\:`, ":", `\=`, "=", `\~`, "~", `\#`, "#", `\{`, "{", `\}`, "}", `\n`, "\n", `\\`, `\`)
+
+// giftIndex returns the index of the first unescaped occurrence of any of
+// chars in s, or -1.
+func giftIndex(s, chars string) int {
+    for i := 0; i < len(s); i++ {
+        if s[i] == '\\' {
+            i++
+            continue
+        }
+        if strings.IndexByte(chars, s[i]) >= 0 {
+            return i
+        }
+    }
+    return -1
+}
+
+// parseGIFT converts questions in Moodle's GIFT format. Multiple choice,
+// true/false and numeric questions are supported; true/false ones become
+// multiple choice between "True" and "False". Anything else, including
+// short answer questions, is reported as a problem. Every question gets
+// seconds to answer it and the given section. IDs are left unset.
+func parseGIFT(cfg *Config, text string, seconds int, section string) ([]Question, []GIFTProblem) {
+    var converted []Question
+    var problems []GIFTProblem
+
+    // Questions are separated by blank lines; // starts a comment line.
+    var block []string
+    start := 0
+    flush := func() {
+        raw := strings.TrimSpace(strings.Join(block, "\n"))
+        block = nil
+        if raw == "" {
+            return
+        }
+        q, err := parseGIFTQuestion(raw)
+        if err != nil {
+            problems = append(problems, GIFTProblem{Line: start, Text: raw, Problem: err.Error()})
+            return
+        }
+        q.Time = seconds
+        q.Section = section
+        if p := validateQuestion(cfg, q); len(p) > 0 {
+            problems = append(problems, GIFTProblem{Line: start, Text: raw, Problem: strings.Join(p, "; ")})
+            return
+        }
+        converted = append(converted, q)
+    }
+    for i, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+        trimmed := strings.TrimSpace(line)
+        switch {
+        case strings.HasPrefix(trimmed, "//"):
+        case strings.HasPrefix(trimmed, "$CATEGORY:"):
+        case trimmed == "":
+            flush()
+        default:
+            if len(block) == 0 {
+                start = i + 1
+            }
+            block = append(block, line)
+        }
+    }
+    flush()
+    return converted, problems
+}
+
+// parseGIFTQuestion converts a single GIFT question.
+func parseGIFTQuestion(raw string) (Question, error) {
+    // An optional ::title:: comes first; it is not kept.
+    if strings.HasPrefix(raw, "::") {
+        end := strings.Index(raw[2:], "::")
+        if end < 0 {
+            return Question{}, fmt.Errorf("unterminated title")
+        }
+        raw = strings.TrimSpace(raw[end+4:])
+    }
+    // Markup hints such as [html] are ignored.
+    if strings.HasPrefix(raw, "[") {
+        if end := strings.Index(raw, "]"); end > 0 {
+            raw = raw[end+1:]
+        }
+    }
+
+    open := giftIndex(raw, "{")
+    if open < 0 {
+        return Question{}, fmt.Errorf("no answer block")
+    }
+    close := giftIndex(raw[open:], "}")
+    if close < 0 {
+        return Question{}, fmt.Errorf("unterminated answer block")
+    }
+    close += open
+    // Text after the answers is part of the question, as in "fill {...} in".
+    questionText := strings.TrimSpace(raw[:open])
+    if rest := strings.TrimSpace(raw[close+1:]); rest != "" {
+        questionText += " _____ " + rest
+    }
+    q := Question{Text: strings.TrimSpace(giftUnescape.Replace(questionText))}
+    answers := strings.TrimSpace(raw[open+1 : close])
+
+    switch strings.ToUpper(giftAnswerOnly(answers)) {
+    case "T", "TRUE":
+        q.Type, q.Options, q.Answer = QuestionMultipleChoice, []string{"True", "False"}, "0"
+        return q, nil
+    case "F", "FALSE":
+        q.Type, q.Options, q.Answer = QuestionMultipleChoice, []string{"True", "False"}, "1"
+        return q, nil
+    }
+
+    if strings.HasPrefix(answers, "#") {
+        return parseGIFTNumeric(q, giftAnswerOnly(answers[1:]))
+    }
+
+    correct := 0
+    for answers != "" {
+        marker := answers[0]
+        if marker != '=' && marker != '~' {
+            return Question{}, fmt.Errorf("unsupported answer %q", answers)
+        }
+        answers = answers[1:]
+        end := giftIndex(answers, "=~")
+        if end < 0 {
+            end = len(answers)
+        }
+        option := giftAnswerOnly(answers[:end])
+        answers = strings.TrimSpace(answers[end:])
+
+        if strings.HasPrefix(option, "%") {
+            return Question{}, fmt.Errorf("weighted answers are not supported")
+        }
+        if strings.Contains(option, "->") {
+            return Question{}, fmt.Errorf("matching questions are not supported")
+        }
+        if marker == '=' {
+            correct++
+            q.Answer = strconv.Itoa(len(q.Options))
+        }
+        q.Options = append(q.Options, giftUnescape.Replace(option))
+    }
+
+    switch {
+    case correct == len(q.Options):
+        return Question{}, fmt.Errorf("short answer questions are not supported")
+    case correct != 1:
+        return Question{}, fmt.Errorf("multiple choice needs exactly one correct answer, found %d", correct)
+    }
+    q.Type = QuestionMultipleChoice
+    return q, nil
+}
+
+// parseGIFTNumeric converts the answer of a numeric question, either
+// value:tolerance or min..max.
+func parseGIFTNumeric(q Question, answer string) (Question, error) {
+    answer = strings.TrimPrefix(answer, "=")
+    q.Type = QuestionNumeric
+    if parts := strings.SplitN(answer, "..", 2); len(parts) == 2 {
+        min, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+        max, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if err1 != nil || err2 != nil || max < min {
+            return Question{}, fmt.Errorf("invalid numeric range %q", answer)
+        }
+        q.Answer = strconv.FormatFloat((min+max)/2, 'f', -1, 64)
+        q.Tolerance = (max - min) / 2
+        return q, nil
+    }
+    parts := strings.SplitN(answer, ":", 2)
+    value, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+    if err != nil {
+        return Question{}, fmt.Errorf("invalid numeric answer %q", answer)
+    }
+    q.Answer = strconv.FormatFloat(value, 'f', -1, 64)
+    if len(parts) == 2 {
+        q.Tolerance, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if err != nil {
+            return Question{}, fmt.Errorf("invalid tolerance %q", parts[1])
+        }
+    }
+    return q, nil
+}
+
+// giftAnswerOnly strips the #feedback from an answer.
+func giftAnswerOnly(s string) string {
+    if i := giftIndex(s, "#"); i >= 0 {
+        s = s[:i]
+    }
+    return strings.TrimSpace(s)
+}
+
+// API endpoint adding the questions of an uploaded bank. The body is the
+// bank in the format named by ?format=, currently only "gift". Questions
+// get ?time= seconds each (default 60) and the ?section= given. Questions
+// that don't convert are reported and skipped.
+func importQuestionsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    if format := r.URL.Query().Get("format"); format != "gift" {
+        http.Error(w, "Unsupported format", http.StatusBadRequest)
+        return
+    }
+    seconds := 60
+    if v := r.URL.Query().Get("time"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            http.Error(w, "Invalid time value", http.StatusBadRequest)
+            return
+        }
+        seconds = n
+    }
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, "Error reading request", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    converted, problems := parseGIFT(cfg, string(body), seconds, r.URL.Query().Get("section"))
+
+    mu.Lock()
+    ids := make([]int, 0, len(converted))
+    for _, q := range converted {
+        q.ID = questionIDCounter
+        questionIDCounter++
+        questions = append(questions, q)
+        ids = append(ids, q.ID)
+    }
+    if len(ids) > 0 {
+        saveQuestions()
+    }
+    recordAudit(admin, "import-questions", fmt.Sprintf("gift: %d imported, %d skipped", len(ids), len(problems)))
+    mu.Unlock()
+
+    if problems == nil {
+        problems = []GIFTProblem{}
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "imported": ids, "problems": problems})
+}
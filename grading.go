@@ -0,0 +1,787 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "html"
+    "log"
+    "math"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ManualGrade is the score an admin gave a manually graded answer.
+type ManualGrade struct {
+    Points  int
+    Comment string // How the answer measured up against the rubric
+    Admin   string
+    Time    time.Time
+}
+
+// ScoreAdjustment records a manual change to a result's score.
+type ScoreAdjustment struct {
+    OriginalScore int // The score as graded, before any adjustment
+    Admin         string
+    Reason        string
+    Time          time.Time
+}
+
+// ResultReassignment records that a result was moved by hand from the exam
+// it was recorded against, e.g. after a client bug.
+type ResultReassignment struct {
+    FromExamID int
+    Regraded   bool // Whether the score was recomputed against the new exam
+    Admin      string
+    Reason     string
+    Time       time.Time
+}
+
+// Reasons an attempt ended, recorded on its Result
+const (
+    EndSubmitted   = "submitted"
+    EndAbandoned   = "abandoned"
+    EndTimeExpired = "time_expired"
+    EndLifetime    = "lifetime_exceeded"
+    EndTerminated  = "terminated" // Stopped at the violation limit
+)
+
+// gradeAnswers scores answers keyed by position in ids, the attempt's
+// questions in served order. Questions deleted from the bank since are not
+// graded. Section scores are only returned for sectioned exams. Caller must
+// hold mu.
+func gradeAnswers(cfg *Config, exam *Exam, ids []int, answers map[string]string) (int, map[string]int) {
+    score := 0
+    var sectionScores map[string]int
+    if exam != nil && len(exam.Sections) > 0 {
+        sectionScores = make(map[string]int)
+        for _, id := range ids {
+            if q := findQuestion(id); q != nil {
+                sectionScores[q.Section] = 0
+            }
+        }
+    }
+
+    for qIndex, userAnswer := range answers {
+        i, err := strconv.Atoi(qIndex)
+        if err != nil || i < 0 || i >= len(ids) {
+            continue
+        }
+        q := findQuestion(ids[i])
+        if q == nil {
+            continue
+        }
+        points := answerPoints(cfg, *q, userAnswer)
+        score += points
+        if sectionScores != nil {
+            sectionScores[q.Section] += points
+        }
+    }
+    return score, sectionScores
+}
+
+// answerPoints returns the points answer earns for q. Most questions are
+// worth one point; ordering and matching questions with PartialCredit earn a
+// point for each item in the right place. Manually graded questions earn
+// nothing here; their points are added when an admin grades them.
+func answerPoints(cfg *Config, q Question, answer string) int {
+    if q.ManualGrading {
+        return 0
+    }
+    switch q.Type {
+    case QuestionOrdering, QuestionMatching:
+        expected, _ := parseIndexList(q.Answer)
+        got, ok := parseIndexList(answer)
+        if !ok || len(got) != len(expected) {
+            return 0
+        }
+        placed := 0
+        for i := range expected {
+            if got[i] == expected[i] {
+                placed++
+            }
+        }
+        if q.PartialCredit {
+            return placed
+        }
+        if placed == len(expected) {
+            return 1
+        }
+        return 0
+    }
+    if answerCorrect(cfg, q, answer) {
+        return 1
+    }
+    return 0
+}
+
+// answerCorrect reports whether answer is a correct response to q.
+func answerCorrect(cfg *Config, q Question, answer string) bool {
+    switch q.Type {
+    case QuestionNumeric:
+        return numericAnswerCorrect(q, answer)
+    case QuestionOrdering, QuestionMatching:
+        expected, _ := parseIndexList(q.Answer)
+        return len(expected) > 0 && answerPoints(cfg, q, answer) == questionPoints(q)
+    default:
+        expected, ok := optionIndex(cfg, q.Answer, q.Options)
+        if !ok {
+            return normalizeAnswer(cfg, answer) == normalizeAnswer(cfg, q.Answer)
+        }
+        got, ok := optionIndex(cfg, answer, q.Options)
+        return ok && got == expected
+    }
+}
+
+var markupPattern = regexp.MustCompile(`<[^>]*>`)
+
+// normalizeAnswer reduces option text to a comparable form: markup removed,
+// entities decoded, whitespace collapsed and, unless
+// Config.CaseSensitiveAnswers is set, case folded.
+func normalizeAnswer(cfg *Config, s string) string {
+    s = html.UnescapeString(markupPattern.ReplaceAllString(s, ""))
+    s = strings.Join(strings.Fields(s), " ")
+    if !cfg.CaseSensitiveAnswers {
+        s = strings.ToLower(s)
+    }
+    return s
+}
+
+// optionLabels returns the letters shown before q's options when exam uses
+// LetterLabels, or nil. Only multiple choice questions with at most 26
+// options are labelled.
+func optionLabels(exam *Exam, q Question) []string {
+    if exam == nil || !exam.LetterLabels || (q.Type != "" && q.Type != QuestionMultipleChoice) || len(q.Options) > 26 {
+        return nil
+    }
+    labels := make([]string, len(q.Options))
+    for i := range labels {
+        labels[i] = string(rune('A' + i))
+    }
+    return labels
+}
+
+// submittedAnswer converts a multiple choice answer as a student sent it to
+// the option index answers are stored and graded by. It may be the option's
+// letter, its text in any of the question's languages, or its index. Text is
+// tried before the index, so options that read as numbers are not mistaken
+// for indexes. Anything else, and answers to other question types, are
+// returned unchanged.
+func submittedAnswer(cfg *Config, exam *Exam, q Question, answer string) string {
+    if q.Type != "" && q.Type != QuestionMultipleChoice {
+        return answer
+    }
+    label := strings.ToUpper(strings.TrimSpace(answer))
+    for i, l := range optionLabels(exam, q) {
+        if l == label {
+            return strconv.Itoa(i)
+        }
+    }
+    if i, ok := matchOption(cfg, answer, q); ok {
+        return strconv.Itoa(i)
+    }
+    return answer
+}
+
+// matchOption finds the option of q that s names, by its text in any of q's
+// languages first and then as an index.
+func matchOption(cfg *Config, s string, q Question) (int, bool) {
+    lists := [][]string{q.Options}
+    langs := make([]string, 0, len(q.Translations))
+    for lang := range q.Translations {
+        langs = append(langs, lang)
+    }
+    sort.Strings(langs)
+    for _, lang := range langs {
+        lists = append(lists, q.Translations[lang].Options)
+    }
+
+    normalized := normalizeAnswer(cfg, s)
+    for _, list := range lists {
+        for i, option := range list {
+            if i < len(q.Options) && normalizeAnswer(cfg, option) == normalized {
+                return i, true
+            }
+        }
+    }
+    i, err := strconv.Atoi(strings.TrimSpace(s))
+    return i, err == nil && i >= 0 && i < len(q.Options)
+}
+
+// optionIndex resolves a stored answer or answer key to one of options.
+// Both are saved as option indexes, converted from whatever the student or
+// admin sent, so a valid index is read as one. Anything else, such as text
+// recorded before answers were converted, is matched by text.
+func optionIndex(cfg *Config, s string, options []string) (int, bool) {
+    s = strings.TrimSpace(s)
+    if i, err := strconv.Atoi(s); err == nil && i >= 0 && i < len(options) {
+        return i, true
+    }
+    normalized := normalizeAnswer(cfg, s)
+    for i, option := range options {
+        if normalizeAnswer(cfg, option) == normalized {
+            return i, true
+        }
+    }
+    return 0, false
+}
+
+// questionPoints returns the most points q can earn.
+func questionPoints(q Question) int {
+    if q.ManualGrading && q.MaxPoints > 0 {
+        return q.MaxPoints
+    }
+    if (q.Type == QuestionOrdering || q.Type == QuestionMatching) && q.PartialCredit {
+        expected, _ := parseIndexList(q.Answer)
+        return len(expected)
+    }
+    return 1
+}
+
+// parseIndexList parses a comma separated list of indexes such as "2,0,1",
+// the form ordering and matching answers take.
+func parseIndexList(s string) ([]int, bool) {
+    if strings.TrimSpace(s) == "" {
+        return nil, false
+    }
+    parts := strings.Split(s, ",")
+    list := make([]int, len(parts))
+    for i, part := range parts {
+        v, err := strconv.Atoi(strings.TrimSpace(part))
+        if err != nil {
+            return nil, false
+        }
+        list[i] = v
+    }
+    return list, true
+}
+
+// numericAnswerCorrect reports whether answer is a number within q.Tolerance
+// of q.Answer. Input that is not a number is simply wrong.
+func numericAnswerCorrect(q Question, answer string) bool {
+    expected, err := strconv.ParseFloat(strings.TrimSpace(q.Answer), 64)
+    if err != nil {
+        return false
+    }
+    got, err := strconv.ParseFloat(strings.TrimSpace(answer), 64)
+    if err != nil || math.IsNaN(got) || math.IsInf(got, 0) {
+        return false
+    }
+    // A tiny epsilon keeps boundary values like 3.14 ± 0.01 = 3.15 inside the range.
+    return math.Abs(got-expected) <= q.Tolerance+1e-9
+}
+
+// finishAttempt grades username's answers, records the result with the
+// reason the attempt ended and closes their exam session. The completion
+// webhook, if configured, is queued and never delays the caller.
+// Caller must hold mu.
+func finishAttempt(cfg *Config, username string, answers map[string]string, reason, submitIP string) Result {
+    examID := 0
+    var exam *Exam
+    var startedAt time.Time
+    var timings []AnswerTiming
+    var disconnections []Disconnection
+    var changes map[string]int
+    inGrace := false
+    ids := attemptQuestionIDs(username, examSessions[username])
+    if session, ok := examSessions[username]; ok {
+        examID = session.ExamID
+        exam = findExam(examID)
+        startedAt = session.AcknowledgedAt
+        timings = answerTimings(cfg, session)
+        disconnections = session.Disconnections
+        changes = answerChangeCounts(session)
+        inGrace = session.SubmittedInGrace
+    }
+
+    score, sectionScores := gradeAnswers(cfg, exam, ids, answers)
+    byID := make(map[int]string, len(answers))
+    for key, answer := range answers {
+        if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(ids) {
+            byID[ids[i]] = answer
+        }
+    }
+
+    result := Result{
+        Username:         username,
+        ExamID:           examID,
+        Score:            score,
+        SectionScores:    sectionScores,
+        StartedAt:        startedAt,
+        SubmittedAt:      time.Now(),
+        LoginIP:          loginIPs[username],
+        SubmitIP:         submitIP,
+        EndReason:        reason,
+        AnswerTimings:    timings,
+        Disconnections:   disconnections,
+        AnswerChanges:    changes,
+        Answers:          byID,
+        QuestionIDs:      ids,
+        SubmittedInGrace: inGrace,
+    }
+    result.GradingPending = len(ungradedResponses(result)) > 0
+    results = append(results, result)
+    delete(examSessions, username)
+    delete(userQuestionIDs, username)
+    if err := saveResults(); err != nil {
+        log.Printf("saving %s: %v", resultsFile, err)
+    }
+
+    if cfg.CompletionWebhookURL != "" {
+        enqueueWebhook(cfg.CompletionWebhookURL, completionWebhookSecret(cfg), map[string]interface{}{
+            "event":     "exam_completed",
+            "endReason": reason,
+            "receipt":   newReceipt(cfg, result),
+        })
+    }
+    return result
+}
+
+// API endpoint listing the correct answer to each of an exam's questions in
+// the order they are served. Every access is audited.
+func answerKeyHandler(w http.ResponseWriter, r *http.Request) {
+    type keyEntry struct {
+        Index     int
+        ID        int
+        Type      string
+        Section   string
+        Text      string
+        Options   []string
+        Matches   []string `json:",omitempty"`
+        Answer    string
+        Tolerance float64 `json:",omitempty"`
+    }
+
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(examID)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    recordAudit(admin, "view-answer-key", fmt.Sprintf("exam %d", examID))
+
+    key := []keyEntry{}
+    for i, q := range examQuestions(exam) {
+        key = append(key, keyEntry{
+            Index:     i,
+            ID:        q.ID,
+            Type:      q.Type,
+            Section:   q.Section,
+            Text:      q.Text,
+            Options:   q.Options,
+            Matches:   q.Matches,
+            Answer:    q.Answer,
+            Tolerance: q.Tolerance,
+        })
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(key)
+}
+
+// API endpoint changing the score of a student's latest result for an exam,
+// either to score or by delta. The graded score is kept on the result.
+func adjustScoreHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("user")
+    examID, err := strconv.Atoi(r.FormValue("exam"))
+    if username == "" || err != nil {
+        http.Error(w, "User and exam are required", http.StatusBadRequest)
+        return
+    }
+    reason := strings.TrimSpace(r.FormValue("reason"))
+    if reason == "" {
+        http.Error(w, "A reason is required", http.StatusBadRequest)
+        return
+    }
+
+    scoreStr, deltaStr := r.FormValue("score"), r.FormValue("delta")
+    if (scoreStr == "") == (deltaStr == "") {
+        http.Error(w, "Give exactly one of score or delta", http.StatusBadRequest)
+        return
+    }
+    value, err := strconv.Atoi(scoreStr + deltaStr)
+    if err != nil {
+        http.Error(w, "Invalid score", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    index := -1
+    for i := len(results) - 1; i >= 0; i-- {
+        if results[i].Username == username && results[i].ExamID == examID {
+            index = i
+            break
+        }
+    }
+    if index == -1 {
+        http.Error(w, "Result not found", http.StatusNotFound)
+        return
+    }
+    res := &results[index]
+
+    newScore := value
+    if deltaStr != "" {
+        newScore = res.Score + value
+    }
+    if newScore < 0 {
+        http.Error(w, "Score cannot be negative", http.StatusBadRequest)
+        return
+    }
+
+    original := res.Score
+    if res.Adjustment != nil {
+        original = res.Adjustment.OriginalScore
+    }
+    recordAudit(admin, "adjust-score", fmt.Sprintf("%s exam %d: %d -> %d (graded %d): %s", username, examID, res.Score, newScore, original, reason))
+    res.Score = newScore
+    res.Adjustment = &ScoreAdjustment{
+        OriginalScore: original,
+        Admin:         admin,
+        Reason:        reason,
+        Time:          time.Now(),
+    }
+    if err := saveResults(); err != nil {
+        log.Printf("saving %s: %v", resultsFile, err)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(res)
+}
+
+// ungradedResponses returns the IDs of res's manually graded answers that
+// have not been scored yet. Caller must hold mu.
+func ungradedResponses(res Result) []int {
+    var ids []int
+    for qid, answer := range res.Answers {
+        q := findQuestion(qid)
+        if q == nil || !q.ManualGrading || strings.TrimSpace(answer) == "" {
+            continue
+        }
+        if _, graded := res.ManualGrades[qid]; !graded {
+            ids = append(ids, qid)
+        }
+    }
+    sort.Ints(ids)
+    return ids
+}
+
+// API endpoint scoring a manually graded answer in a student's latest result
+// for an exam. Regrading replaces the earlier grade; the result's totals
+// move by the difference.
+func gradeResponseHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("user")
+    examID, err := strconv.Atoi(r.FormValue("exam"))
+    if username == "" || err != nil {
+        http.Error(w, "User and exam are required", http.StatusBadRequest)
+        return
+    }
+    questionID, err := strconv.Atoi(r.FormValue("question"))
+    if err != nil {
+        http.Error(w, "Invalid question ID", http.StatusBadRequest)
+        return
+    }
+    points, err := strconv.Atoi(r.FormValue("points"))
+    if err != nil {
+        http.Error(w, "Invalid points", http.StatusBadRequest)
+        return
+    }
+    comment := strings.TrimSpace(r.FormValue("comment"))
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    index := -1
+    for i := len(results) - 1; i >= 0; i-- {
+        if results[i].Username == username && results[i].ExamID == examID {
+            index = i
+            break
+        }
+    }
+    if index == -1 {
+        http.Error(w, "Result not found", http.StatusNotFound)
+        return
+    }
+    res := &results[index]
+
+    q := findQuestion(questionID)
+    if q == nil || !q.ManualGrading {
+        http.Error(w, "Question is not graded by hand", http.StatusBadRequest)
+        return
+    }
+    if _, answered := res.Answers[questionID]; !answered {
+        http.Error(w, "The student did not answer this question", http.StatusNotFound)
+        return
+    }
+    if points < 0 || points > questionPoints(*q) {
+        http.Error(w, fmt.Sprintf("Points must be between 0 and %d", questionPoints(*q)), http.StatusBadRequest)
+        return
+    }
+
+    delta := points
+    if previous, ok := res.ManualGrades[questionID]; ok {
+        delta -= previous.Points
+    }
+    if res.ManualGrades == nil {
+        res.ManualGrades = make(map[int]ManualGrade)
+    }
+    res.ManualGrades[questionID] = ManualGrade{
+        Points:  points,
+        Comment: comment,
+        Admin:   admin,
+        Time:    time.Now(),
+    }
+    res.Score += delta
+    if res.Adjustment != nil {
+        res.Adjustment.OriginalScore += delta
+    }
+    if res.SectionScores != nil {
+        res.SectionScores[q.Section] += delta
+    }
+    res.GradingPending = len(ungradedResponses(*res)) > 0
+    if err := saveResults(); err != nil {
+        log.Printf("saving %s: %v", resultsFile, err)
+    }
+    recordAudit(admin, "grade-response", fmt.Sprintf("%s exam %d question %d: %d points", username, examID, questionID, points))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(res)
+}
+
+// regradeResult grades res's stored answers against the current answer key.
+// Manual grades stand; answers to questions deleted since earn nothing.
+// Caller must hold mu.
+func regradeResult(cfg *Config, res Result) (int, map[string]int) {
+    var sectionScores map[string]int
+    if res.SectionScores != nil {
+        sectionScores = make(map[string]int, len(res.SectionScores))
+        for section := range res.SectionScores {
+            sectionScores[section] = 0
+        }
+    }
+
+    score := 0
+    for qid, answer := range res.Answers {
+        q := findQuestion(qid)
+        if q == nil {
+            continue
+        }
+        points := answerPoints(cfg, *q, answer)
+        if grade, ok := res.ManualGrades[qid]; ok {
+            points = grade.Points
+        }
+        score += points
+        if sectionScores != nil {
+            sectionScores[q.Section] += points
+        }
+    }
+    return score, sectionScores
+}
+
+// API endpoint regrading every result of an exam against the current answer
+// key, after a wrong answer was corrected. Hand adjustments are kept on top
+// of the new graded score. Results recorded before answers were stored
+// can't be regraded and are counted as skipped. It requires a
+// "recompute-results" confirmation token.
+func recomputeResultsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    type change struct {
+        Username    string
+        SubmittedAt time.Time
+        Before      int
+        After       int
+    }
+
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if !consumeConfirmation("recompute-results", r.URL.Query().Get("confirm")) {
+        http.Error(w, "Missing or invalid confirmation token", http.StatusForbidden)
+        return
+    }
+    if findExam(examID) == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    changes := []change{}
+    regraded, skipped := 0, 0
+    for i := range results {
+        res := &results[i]
+        if res.ExamID != examID {
+            continue
+        }
+        if res.Answers == nil {
+            skipped++
+            continue
+        }
+        regraded++
+
+        graded, sectionScores := regradeResult(cfg, *res)
+        before := res.Score
+        if res.Adjustment != nil {
+            res.Score += graded - res.Adjustment.OriginalScore
+            res.Adjustment.OriginalScore = graded
+        } else {
+            res.Score = graded
+        }
+        res.SectionScores = sectionScores
+        if res.Score != before {
+            log.Printf("recompute-results exam %d: %s submitted %s: %d -> %d", examID, res.Username, res.SubmittedAt.Format(time.RFC3339), before, res.Score)
+            changes = append(changes, change{res.Username, res.SubmittedAt, before, res.Score})
+        }
+    }
+    if err := saveResults(); err != nil {
+        log.Printf("saving %s: %v", resultsFile, err)
+    }
+    recordAudit(admin, "recompute-results", fmt.Sprintf("exam %d: %d regraded, %d changed, %d skipped", examID, regraded, len(changes), skipped))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "regraded": regraded, "skipped": skipped, "changes": changes})
+}
+
+// API endpoint moving a student's result for exam to the exam given as to,
+// when it was recorded against the wrong one. With regrade=true the stored
+// answers are graded again against the new exam's questions; answers to
+// questions outside it earn nothing. Hand adjustments are kept on top of the
+// new graded score. The result is marked as reassigned.
+func reassignResultHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("user")
+    examID, err1 := strconv.Atoi(r.FormValue("exam"))
+    targetID, err2 := strconv.Atoi(r.FormValue("to"))
+    if username == "" || err1 != nil || err2 != nil {
+        http.Error(w, "User, exam and to are required", http.StatusBadRequest)
+        return
+    }
+    if examID == targetID {
+        http.Error(w, "The result is already recorded against that exam", http.StatusBadRequest)
+        return
+    }
+    regrade := false
+    if v := r.FormValue("regrade"); v != "" {
+        var err error
+        if regrade, err = strconv.ParseBool(v); err != nil {
+            http.Error(w, "Invalid regrade value", http.StatusBadRequest)
+            return
+        }
+    }
+    reason := strings.TrimSpace(r.FormValue("reason"))
+    if reason == "" {
+        http.Error(w, "A reason is required", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    target := findExam(targetID)
+    if target == nil {
+        http.Error(w, "Target exam not found", http.StatusNotFound)
+        return
+    }
+    index := -1
+    for i := len(results) - 1; i >= 0; i-- {
+        if results[i].Username == username && results[i].ExamID == examID {
+            index = i
+            break
+        }
+    }
+    if index == -1 {
+        http.Error(w, "Result not found", http.StatusNotFound)
+        return
+    }
+    for _, res := range results {
+        if res.Username == username && res.ExamID == targetID {
+            http.Error(w, "The student already has a result for the target exam", http.StatusConflict)
+            return
+        }
+    }
+    res := &results[index]
+    if regrade && res.Answers == nil {
+        http.Error(w, "The result's answers are no longer stored, so it can't be regraded", http.StatusConflict)
+        return
+    }
+
+    before := res.Score
+    if regrade {
+        inExam := make(map[int]bool)
+        for _, q := range assignedQuestions(target) {
+            inExam[q.ID] = true
+        }
+        moved := Result{Answers: make(map[int]string), ManualGrades: res.ManualGrades}
+        for qid, answer := range res.Answers {
+            if inExam[qid] {
+                moved.Answers[qid] = answer
+            }
+        }
+        if len(target.Sections) > 0 {
+            moved.SectionScores = make(map[string]int, len(target.Sections))
+            for _, section := range target.Sections {
+                moved.SectionScores[section.Name] = 0
+            }
+        }
+        graded, sectionScores := regradeResult(cfg, moved)
+        if res.Adjustment != nil {
+            res.Score += graded - res.Adjustment.OriginalScore
+            res.Adjustment.OriginalScore = graded
+        } else {
+            res.Score = graded
+        }
+        res.SectionScores = sectionScores
+    }
+    res.ExamID = targetID
+    res.GradingPending = len(ungradedResponses(*res)) > 0
+    res.Reassignment = &ResultReassignment{
+        FromExamID: examID,
+        Regraded:   regrade,
+        Admin:      admin,
+        Reason:     reason,
+        Time:       time.Now(),
+    }
+    log.Printf("reassign-result %s: exam %d -> %d, score %d -> %d", username, examID, targetID, before, res.Score)
+    if err := saveResults(); err != nil {
+        log.Printf("saving %s: %v", resultsFile, err)
+    }
+    recordAudit(admin, "reassign-result", fmt.Sprintf("%s exam %d -> %d (regrade %t, score %d -> %d): %s", username, examID, targetID, regrade, before, res.Score, reason))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+    "net/url"
+    "strings"
+    "testing"
+)
+
+func TestNumericAnswerCorrect(t *testing.T) {
+    q := Question{Type: QuestionNumeric, Answer: "3.14", Tolerance: 0.01}
+    tests := []struct {
+        answer string
+        want   bool
+    }{
+        {"3.14", true},
+        {" 3.14 ", true},
+        {"3.13", true}, // Lower bound
+        {"3.15", true}, // Upper bound
+        {"3.1299", false},
+        {"3.1501", false},
+        {"314e-2", true},
+        {"", false},
+        {"pi", false},
+        {"3.14abc", false},
+        {"3,14", false},
+        {"NaN", false},
+        {"Inf", false},
+        {"-Inf", false},
+    }
+    for _, tt := range tests {
+        if got := numericAnswerCorrect(q, tt.answer); got != tt.want {
+            t.Errorf("numericAnswerCorrect(%q) = %v, want %v", tt.answer, got, tt.want)
+        }
+    }
+}
+
+func TestNumericAnswerCorrectExact(t *testing.T) {
+    q := Question{Type: QuestionNumeric, Answer: "42"}
+    tests := []struct {
+        answer string
+        want   bool
+    }{
+        {"42", true},
+        {"42.0", true},
+        {"42.0001", false},
+        {"41.9999", false},
+        {"forty-two", false},
+    }
+    for _, tt := range tests {
+        if got := numericAnswerCorrect(q, tt.answer); got != tt.want {
+            t.Errorf("numericAnswerCorrect(%q) = %v, want %v", tt.answer, got, tt.want)
+        }
+    }
+}
+
+func TestNumericAnswerCorrectBadKey(t *testing.T) {
+    q := Question{Type: QuestionNumeric, Answer: "about 3"}
+    if numericAnswerCorrect(q, "3") {
+        t.Error("an answer was accepted against a key that is not a number")
+    }
+}
+
+func TestAnswerPointsOrderingAndMatching(t *testing.T) {
+    ordering := Question{Type: QuestionOrdering, Options: []string{"a", "b", "c", "d"}, Answer: "2,0,3,1"}
+    orderingPartial := ordering
+    orderingPartial.PartialCredit = true
+    matching := Question{Type: QuestionMatching, Options: []string{"x", "y", "z"}, Matches: []string{"1", "2", "3"}, Answer: "1,2,0"}
+    matchingPartial := matching
+    matchingPartial.PartialCredit = true
+
+    tests := []struct {
+        name   string
+        q      Question
+        answer string
+        want   int
+    }{
+        {"ordering exact", ordering, "2,0,3,1", 1},
+        {"ordering exact with spaces", ordering, " 2, 0 ,3,1 ", 1},
+        {"ordering partly right", ordering, "2,0,1,3", 0},
+        {"ordering partial credit exact", orderingPartial, "2,0,3,1", 4},
+        {"ordering partial credit two placed", orderingPartial, "2,0,1,3", 2},
+        {"ordering partial credit none placed", orderingPartial, "0,1,2,3", 0},
+        {"ordering too short", orderingPartial, "2,0,3", 0},
+        {"ordering too long", orderingPartial, "2,0,3,1,1", 0},
+        {"ordering not numbers", orderingPartial, "c,a,d,b", 0},
+        {"ordering empty", orderingPartial, "", 0},
+        {"ordering trailing comma", orderingPartial, "2,0,3,", 0},
+        {"matching exact", matching, "1,2,0", 1},
+        {"matching one wrong", matching, "1,0,0", 0},
+        {"matching partial credit exact", matchingPartial, "1,2,0", 3},
+        {"matching partial credit one right", matchingPartial, "1,0,2", 1},
+        {"matching too short", matchingPartial, "1,2", 0},
+        {"matching malformed", matchingPartial, "1;2;0", 0},
+    }
+    for _, tt := range tests {
+        if got := answerPoints(testConfig, tt.q, tt.answer); got != tt.want {
+            t.Errorf("%s: answerPoints(testConfig, %q) = %d, want %d", tt.name, tt.answer, got, tt.want)
+        }
+    }
+}
+
+func TestAnswerCorrectOrderingPartialCredit(t *testing.T) {
+    q := Question{Type: QuestionOrdering, Options: []string{"a", "b", "c"}, Answer: "2,1,0", PartialCredit: true}
+    if !answerCorrect(testConfig, q, "2,1,0") {
+        t.Error("the exact order was not correct")
+    }
+    if answerCorrect(testConfig, q, "2,0,1") {
+        t.Error("a partly right order was fully correct")
+    }
+    if got := questionPoints(q); got != 3 {
+        t.Errorf("questionPoints = %d, want 3", got)
+    }
+}
+
+// grade converts answer as a submission and reports whether it is correct.
+func grade(exam *Exam, q Question, answer string) bool {
+    return answerCorrect(testConfig, q, submittedAnswer(testConfig, exam, q, answer))
+}
+
+func TestSubmissionStyles(t *testing.T) {
+    cities := Question{
+        Options:      []string{"Paris", "London", "<b>Rome</b>"},
+        Answer:       "0",
+        Translations: map[string]QuestionText{"fr": {Text: "Capitale?", Options: []string{"Paris", "Londres", "Rome"}}},
+    }
+    romeKey := cities
+    romeKey.Answer = "2"
+    londonKey := cities
+    londonKey.Answer = "1"
+    numbers := Question{Options: []string{"1", "2", "3"}, Answer: "1"} // The key is "2"
+    labelled := &Exam{LetterLabels: true}
+
+    tests := []struct {
+        name   string
+        exam   *Exam
+        q      Question
+        answer string
+        want   bool
+    }{
+        {"index", nil, cities, "0", true},
+        {"index with spaces", nil, cities, " 0 ", true},
+        {"wrong index", nil, cities, "1", false},
+        {"index out of range", nil, cities, "7", false},
+        {"negative index", nil, cities, "-1", false},
+        {"text", nil, cities, "Paris", true},
+        {"text in another case", nil, cities, "  paris ", true},
+        {"wrong text", nil, cities, "London", false},
+        {"unknown text", nil, cities, "Berlin", false},
+        {"text without markup", nil, romeKey, "Rome", true},
+        {"text with markup", nil, romeKey, "<b>Rome</b>", true},
+        {"translated text", nil, londonKey, "Londres", true},
+        {"wrong translated text", nil, cities, "Londres", false},
+        {"empty", nil, cities, "", false},
+        {"letter", labelled, cities, "a", true},
+        {"wrong letter", labelled, cities, "B", false},
+        {"letter without labels", nil, cities, "A", false},
+        {"numeric text", nil, numbers, "2", true},
+        {"numeric text that is also an index", nil, numbers, "1", false},
+        {"numeric text, wrong option", nil, numbers, "3", false},
+        {"index past the numeric options", nil, numbers, "0", false},
+    }
+    for _, tt := range tests {
+        if got := grade(tt.exam, tt.q, tt.answer); got != tt.want {
+            t.Errorf("%s: %q graded %v, want %v", tt.name, tt.answer, got, tt.want)
+        }
+    }
+}
+
+func TestSubmittedAnswerStoresIndex(t *testing.T) {
+    q := Question{Options: []string{"10", "20", "30"}}
+    tests := map[string]string{
+        "20":        "1", // Text first
+        "2":         "2", // No option reads 2, so it is an index
+        " 30 ":      "2",
+        "Berlin":    "Berlin",
+        "":          "",
+        "1,2,0":     "1,2,0",
+        "<i>10</i>": "0",
+    }
+    for answer, want := range tests {
+        if got := submittedAnswer(testConfig, nil, q, answer); got != want {
+            t.Errorf("submittedAnswer(testConfig, %q) = %q, want %q", answer, got, want)
+        }
+    }
+
+    ordering := Question{Type: QuestionOrdering, Options: []string{"a", "b"}}
+    if got := submittedAnswer(testConfig, nil, ordering, "1,0"); got != "1,0" {
+        t.Errorf("an ordering answer was converted to %q", got)
+    }
+}
+
+func TestNumericTextKey(t *testing.T) {
+    resetState(t, 0)
+    w := serve(withConfig(testConfig, addQuestionHandler), "/add-question", url.Values{
+        "question": {"Which is twenty?"},
+        "options":  {"10,20,30"},
+        "answer":   {"20"},
+        "time":     {"30"},
+    })
+    if !strings.Contains(w.Body.String(), `"success":"true"`) {
+        t.Fatalf("adding a question keyed by numeric text: %s", w.Body.String())
+    }
+    mu.Lock()
+    key := questions[len(questions)-1].Answer
+    mu.Unlock()
+    if key != "1" {
+        t.Errorf("key stored as %q, want index 1", key)
+    }
+
+    dup := Question{Options: []string{"Yes", " yes "}, Answer: "0", Time: 30, Text: "?"}
+    if problems := validateQuestion(testConfig, dup); len(problems) == 0 {
+        t.Error("options that read the same were accepted")
+    }
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+)
+
+// Disconnection is a stretch of an exam during which no heartbeat arrived.
+type Disconnection struct {
+    From time.Time
+    To   time.Time
+}
+
+// online reports whether the session's client has been heard from within
+// Config.OfflineAfterSeconds of now.
+func online(cfg *Config, session *ExamSession, now time.Time) bool {
+    return now.Sub(session.LastSeen) <= time.Duration(cfg.OfflineAfterSeconds)*time.Second
+}
+
+// API endpoint the proctor page pings to show the student is still connected
+func heartbeatHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+    now := time.Now()
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    // A heartbeat after the client went offline closes the disconnection.
+    if !online(cfg, session, now) {
+        session.Disconnections = append(session.Disconnections, Disconnection{From: session.LastSeen, To: now})
+    }
+    session.LastSeen = now
+
+    resp := map[string]string{"success": "true"}
+    if !session.AcknowledgedAt.IsZero() && recheckRequired(session, now) {
+        resp["faceRecheck"] = "true"
+    }
+    if allowedAt := submitAllowedAt(session); now.Before(allowedAt) {
+        resp["submitAllowedAt"] = allowedAt.Format(time.RFC3339)
+    }
+    // The page moves on when the question on screen has run out of time.
+    for _, index := range expireQuestions(session, findExam(session.ExamID), now) {
+        if index == userQuestionIndex[username]-1 {
+            resp["questionExpired"] = strconv.Itoa(index)
+        }
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// API endpoint listing every active exam session and whether its student is
+// currently connected
+func progressHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    type sessionProgress struct {
+        Username       string
+        ExamID         int
+        QuestionIndex  int
+        Answered       int
+        Online         bool
+        LastSeen       time.Time
+        Disconnections []Disconnection
+    }
+
+    now := time.Now()
+
+    mu.Lock()
+    list := make([]sessionProgress, 0, len(examSessions))
+    for username, session := range examSessions {
+        list = append(list, sessionProgress{
+            Username:       username,
+            ExamID:         session.ExamID,
+            QuestionIndex:  userQuestionIndex[username],
+            Answered:       len(session.Answers),
+            Online:         online(cfg, session, now),
+            LastSeen:       session.LastSeen,
+            Disconnections: append([]Disconnection(nil), session.Disconnections...),
+        })
+    }
+    mu.Unlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
+
+// API endpoint counting, for an exam, the students who have completed it,
+// are taking it now and have not started it
+func completionCountHandler(w http.ResponseWriter, r *http.Request) {
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    if findExam(id) == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    completed := make(map[string]bool)
+    for _, res := range results {
+        if res.ExamID == id {
+            completed[res.Username] = true
+        }
+    }
+    inProgress := make(map[string]bool)
+    for username, session := range examSessions {
+        if session.ExamID == id && !session.Terminated {
+            inProgress[username] = true
+        }
+    }
+    notStarted := 0
+    for _, s := range students {
+        if !completed[s.Username] && !inProgress[s.Username] {
+            notStarted++
+        }
+    }
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]int{
+        "completed":  len(completed),
+        "inProgress": len(inProgress),
+        "notStarted": notStarted,
+    })
+}
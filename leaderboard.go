@@ -0,0 +1,86 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "time"
+)
+
+// defaultLeaderboardSize is how many entries a leaderboard shows when the
+// exam does not set LeaderboardSize.
+const defaultLeaderboardSize = 10
+
+// API endpoint ranking the best score of each student who took an exam.
+// Ties go to the earlier submission. Only exams with Leaderboard set have one.
+func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    type leaderboardEntry struct {
+        Rank        int
+        Username    string
+        Score       int
+        SubmittedAt time.Time
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    exam := findExam(id)
+    if exam == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    if !exam.Leaderboard {
+        mu.Unlock()
+        http.Error(w, "This exam has no leaderboard", http.StatusForbidden)
+        return
+    }
+    size := exam.LeaderboardSize
+    if size <= 0 {
+        size = defaultLeaderboardSize
+    }
+    anonymous := exam.LeaderboardAnonymous
+
+    best := make(map[string]Result)
+    for _, res := range results {
+        if res.ExamID != id {
+            continue
+        }
+        if prev, ok := best[res.Username]; !ok || res.Score > prev.Score {
+            best[res.Username] = res
+        }
+    }
+    mu.Unlock()
+
+    entries := make([]leaderboardEntry, 0, len(best))
+    for _, res := range best {
+        entries = append(entries, leaderboardEntry{Username: res.Username, Score: res.Score, SubmittedAt: res.SubmittedAt})
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        if entries[i].Score != entries[j].Score {
+            return entries[i].Score > entries[j].Score
+        }
+        return entries[i].SubmittedAt.Before(entries[j].SubmittedAt)
+    })
+    if len(entries) > size {
+        entries = entries[:size]
+    }
+    for i := range entries {
+        entries[i].Rank = i + 1
+        if anonymous {
+            entries[i].Username = fmt.Sprintf("Student %d", i+1)
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(entries)
+}
@@ -1,37 +1,64 @@
 package main
 
 import (
+    "crypto/hmac"
     "encoding/base64"
     "encoding/json"
+    "flag"
     "fmt"
     "html/template"
     "io/ioutil"
+    "log"
+    "math/rand"
     "net/http"
     "net/url"
     "os"
     "path/filepath"
+    "sort"
     "strconv"
     "strings"
     "sync"
+    "time"
 )
 
-var templates = template.Must(template.ParseGlob("templates/*.html"))
+// Page templates, parsed in main once the templates directory exists
+var templates *template.Template
 
 // --- User and Data Structures ---
 var studentUser = map[string]string{
     "student1": "1234",
 }
-var adminUser = map[string]string{
-    "admin": "admin123",
-}
-var exams = []string{
-    "Math Exam - Grade 10",
-    "Science Exam - Grade 10",
-}
 
 type Result struct {
-    Username string
-    Score    int
+    Username       string
+    ExamID         int
+    Score          int
+    SectionScores  map[string]int // Score per section name, for sectioned exams
+    StartedAt      time.Time      // When the student acknowledged the instructions
+    SubmittedAt    time.Time
+    LoginIP        string
+    SubmitIP       string
+    EndReason      string          // How the attempt ended, e.g. EndSubmitted or EndAbandoned
+    AnswerTimings  []AnswerTiming  `json:",omitempty"`
+    Disconnections []Disconnection `json:",omitempty"`
+    // AnswerChanges counts changes per answer for exams that track them.
+    AnswerChanges map[string]int `json:",omitempty"`
+    // Answers holds the graded answers keyed by question ID, and QuestionIDs
+    // the questions served in order. Both are dropped after
+    // Config.AnswerRetentionDays.
+    Answers     map[int]string `json:",omitempty"`
+    QuestionIDs []int          `json:",omitempty"`
+    // SubmittedInGrace is set when the submission arrived after the deadline,
+    // within the grace allowed for slow networks.
+    SubmittedInGrace bool `json:",omitempty"`
+    // Adjustment is set once the score has been changed by hand.
+    Adjustment *ScoreAdjustment `json:",omitempty"`
+    // Reassignment is set once the result has been moved to another exam.
+    Reassignment *ResultReassignment `json:",omitempty"`
+    // ManualGrades holds the scores given to manually graded answers, keyed
+    // by question ID. GradingPending is set while any are still missing.
+    ManualGrades   map[int]ManualGrade `json:",omitempty"`
+    GradingPending bool                `json:",omitempty"`
 }
 
 type Violation struct {
@@ -41,14 +68,79 @@ type Violation struct {
 
 type Student struct {
     Username string
+    Language string // Preferred question language, if any
 }
 
+// Question types; an empty Type is multiple choice
+const (
+    QuestionMultipleChoice = "multiple_choice"
+    QuestionNumeric        = "numeric"
+    // Ordering and matching answers are comma separated option indexes: the
+    // items in order, or the match chosen for each item.
+    QuestionOrdering = "ordering"
+    QuestionMatching = "matching"
+    // Short answers are free text, matched against Answer unless the
+    // question is graded by hand.
+    QuestionShortAnswer = "short_answer"
+)
+
 type Question struct {
-    ID      int
+    ID        int
+    Type      string
+    Text      string
+    Options   []string
+    Answer    string
+    Time      int     // Time in seconds
+    Section   string  // Name of the exam section the question belongs to
+    AudioPath string  // Optional audio clip for listening questions
+    Tolerance float64 // Accepted distance from Answer for numeric questions
+    // Matches is the second column a matching question's options pair with.
+    Matches []string
+    // PartialCredit awards ordering and matching questions a point per item
+    // in the right place instead of one point for a fully correct answer.
+    PartialCredit bool
+    // Translations maps a language code to the question in that language.
+    // Options keep the same order so answers stay index based.
+    Translations map[string]QuestionText
+    // ManualGrading leaves a short answer question for an admin to score
+    // against Rubric, for up to MaxPoints (0 means 1).
+    ManualGrading bool   `json:",omitempty"`
+    Rubric        string `json:",omitempty"`
+    MaxPoints     int    `json:",omitempty"`
+    // ExamOnly keeps the question out of the whole bank served by exams
+    // without assigned questions, so only exams listing it serve it. The
+    // copies made by cloning an exam are marked.
+    ExamOnly bool `json:",omitempty"`
+}
+
+type QuestionText struct {
     Text    string
     Options []string
-    Answer  string
-    Time    int // Time in seconds
+}
+
+// StudentQuestion is the view of a Question served to students; it never
+// carries the answer.
+type StudentQuestion struct {
+    ID       int
+    Index    int // Position the question was served at; answers are keyed by it
+    Type     string
+    Text     string
+    Options  []string
+    Matches  []string `json:",omitempty"`
+    Time     int
+    Section  string
+    AudioURL string `json:",omitempty"`
+    // Labels holds the letter shown before each option in exams with
+    // LetterLabels; answers may be given by letter.
+    Labels []string `json:",omitempty"`
+    // BankRemaining is the seconds left in a time bank exam's shared budget.
+    BankRemaining int `json:",omitempty"`
+    // SectionStart is set on the first question of a section so the UI can
+    // show the section's introduction.
+    SectionStart *Section `json:",omitempty"`
+    // Preload lists the media URLs of the question served next, for the
+    // page to fetch ahead of time.
+    Preload []string `json:",omitempty"`
 }
 
 var results []Result
@@ -61,43 +153,63 @@ var questionIDCounter = 1
 // Track user's current question index
 var userQuestionIndex = make(map[string]int)
 
+// Questions of students answering without an exam session, fixed when they
+// are first served like a session's QuestionIDs
+var userQuestionIDs = make(map[string][]int)
+
 // Store reference faces for each user
 var userReferenceFaces = make(map[string]string)
 
 func main() {
+    configPath := flag.String("config", "", "path to a JSON config file")
+    flag.Parse()
+
+    cfg, err := loadConfig(*configPath)
+    if err != nil {
+        log.Fatalf("loading config: %v", err)
+    }
+    loadReceiptSecret(cfg)
+    faceSlots = make(chan struct{}, cfg.FaceServiceConcurrency)
+    faceClient = &http.Client{Timeout: time.Duration(cfg.FaceServiceTimeoutSeconds) * time.Second}
+
     os.MkdirAll("captured_images", os.ModePerm)
-    os.MkdirAll("reference_faces", os.ModePerm)
-    os.MkdirAll("templates", os.ModePerm)
+    os.MkdirAll("question_audio", os.ModePerm)
+
+    templates, err = loadTemplates("templates")
+    if err != nil {
+        log.Fatalf("loading templates from templates/ (run from the repository root): %v", err)
+    }
 
     loadExistingStudents()
+    loadAdmins()
+    loadExams()
+    loadResults()
+    loadViolations()
+    loadQuestionFlags()
+    loadQuestions()
+    loadNoticeAcks()
+    logExamProblems(cfg)
+
+    for i := 0; i < webhookWorkers; i++ {
+        go runWebhookWorker(cfg)
+    }
+    go runEmailWorker(cfg)
+    go runCaptureCleanup(cfg)
+    go runAnswerCleanup(cfg)
+    go runSessionSweeper(cfg)
+
+    fmt.Printf("Proctor %s (%s, built %s)\n", version, commit, buildTime)
+    fmt.Println("Server running on " + cfg.ListenAddr)
+    log.Fatal(http.ListenAndServe(cfg.ListenAddr, newRouter(cfg)))
+}
 
-    http.HandleFunc("/", loginPage)
-    http.HandleFunc("/login", loginHandler)
-    http.HandleFunc("/exam", examPage)
-    http.HandleFunc("/proctor", proctorPage)
-    http.HandleFunc("/capture", captureHandler)
-    http.HandleFunc("/submit", submitHandler)
-    http.HandleFunc("/score", scorePage)
-    http.HandleFunc("/admin", adminPage)
-    http.HandleFunc("/admin-login", ServeadminloginPage)
-    http.HandleFunc("/selection", ServeselectionPage)
-    http.HandleFunc("/add-question-page", Serveaddquestion) // Serves the management page
-    // --- NEW/UPDATED Handlers for Question Management ---
-    http.HandleFunc("/add-question", addQuestionHandler)
-    http.HandleFunc("/api/questions", getQuestionsHandler)   // API to get all questions
-    http.HandleFunc("/delete-question", deleteQuestionHandler) // API to delete a question
-    // Other handlers
-    http.HandleFunc("/add-student", addStudentHandler)
-    http.HandleFunc("/delete-student", deleteStudentHandler)
-    http.HandleFunc("/reference-images/", serveReferenceImage)
-    http.HandleFunc("/fullscreen-violation", fullscreenViolationHandler)
-    http.HandleFunc("/tab-change-violation", tabChangeViolationHandler)
-    http.HandleFunc("/window-change-violation", windowChangeViolationHandler)
-    http.HandleFunc("/validate-face", validateFaceHandler)
-    http.HandleFunc("/get-next-question", getNextQuestionHandler)
-
-    fmt.Println("Server running on http://localhost:8080")
-    http.ListenAndServe(":8080", nil)
+// loadTemplates creates dir if it is missing and parses the pages in it. It
+// fails when dir holds no pages rather than leaving every page blank.
+func loadTemplates(dir string) (*template.Template, error) {
+    if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+        return nil, err
+    }
+    return template.ParseGlob(filepath.Join(dir, "*.html"))
 }
 
 // Load existing students from reference_faces directory
@@ -106,9 +218,16 @@ func loadExistingStudents() {
     defer mu.Unlock()
 
     files, err := ioutil.ReadDir("reference_faces")
-    if err != nil {
+    if os.IsNotExist(err) {
+        log.Printf("reference_faces does not exist; creating it")
+        if err := os.MkdirAll("reference_faces", os.ModePerm); err != nil {
+            log.Fatalf("creating reference_faces: %v", err)
+        }
         return
     }
+    if err != nil {
+        log.Fatalf("reading reference_faces: %v", err)
+    }
 
     for _, file := range files {
         if !file.IsDir() && strings.HasSuffix(file.Name(), ".jpg") {
@@ -117,6 +236,9 @@ func loadExistingStudents() {
             userReferenceFaces[username] = filepath.Join("reference_faces", file.Name())
         }
     }
+    if len(students) == 0 {
+        log.Printf("no reference faces in reference_faces; no student can log in until one is added")
+    }
 }
 
 // --- Page Renderers ---
@@ -128,55 +250,112 @@ func examPage(w http.ResponseWriter, r *http.Request) {
     username := r.URL.Query().Get("user")
     data := struct {
         Username string
-        Exams    []string
-    }{username, exams}
+        Exams    []Exam
+        Branding Branding
+    }{username, exams, defaultBranding}
     templates.ExecuteTemplate(w, "exam.html", data)
 }
 
-func proctorPage(w http.ResponseWriter, r *http.Request) {
+func proctorPage(cfg *Config, w http.ResponseWriter, r *http.Request) {
     username := r.URL.Query().Get("user")
-    exam := r.URL.Query().Get("exam")
+    examID, _ := examIDParam(r, "exam")
 
     mu.Lock()
-    userQuestionIndex[username] = 0
+    exam := findExam(examID)
+    if exam == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    examTitle := exam.Title
+    branding := examBranding(exam)
+    sectionSubmission := exam.SectionSubmission && len(exam.Sections) > 0
+    // Reopening the page mid-exam resumes the attempt instead of restarting it.
+    if session, ok := examSessions[username]; ok && session.ExamID == examID && !session.Terminated {
+        session.Resumed = true
+    } else if len(examProblems(cfg, exam)) > 0 {
+        mu.Unlock()
+        http.Error(w, "This exam is not ready to be taken yet. Please contact your proctor.", http.StatusConflict)
+        return
+    } else {
+        userQuestionIndex[username] = 0
+        delete(userQuestionIDs, username)
+        startExamSession(username, examID)
+    }
     mu.Unlock()
 
     data := struct {
-        Username string
-        Exam     string
-    }{username, exam}
+        Username  string
+        ExamID    int
+        ExamTitle string
+        Branding  Branding
+        // SectionSubmission has the page submit each section as it is left.
+        SectionSubmission bool
+    }{username, examID, examTitle, branding, sectionSubmission}
 
     templates.ExecuteTemplate(w, "proctor.html", data)
 }
 
-func scorePage(w http.ResponseWriter, r *http.Request) {
+func scorePage(cfg *Config, w http.ResponseWriter, r *http.Request) {
     username := r.URL.Query().Get("user")
     scoreStr := r.URL.Query().Get("score")
     score, _ := strconv.Atoi(scoreStr)
 
+    // Prefer the recorded result over the score in the URL, but only for
+    // whoever holds its receipt signature: the page is public, and anyone
+    // could otherwise read a student's result by naming them.
+    token := r.URL.Query().Get("receipt")
+    var receipt *Receipt
+    branding := defaultBranding
+    gradingPending := false
+    mu.Lock()
+    if res, ok := latestResult(username); ok && token != "" {
+        rc := newReceipt(cfg, res)
+        if hmac.Equal([]byte(token), []byte(rc.Signature)) {
+            receipt = &rc
+            score = res.Score
+            branding = examBranding(findExam(res.ExamID))
+            gradingPending = res.GradingPending
+        }
+    }
+    mu.Unlock()
+
+    receiptJSON := ""
+    if receipt != nil {
+        b, _ := json.MarshalIndent(receipt, "", "  ")
+        receiptJSON = string(b)
+    }
+
     data := struct {
-        Username string
-        Score    int
-    }{username, score}
+        Username    string
+        Score       int
+        Receipt     *Receipt
+        ReceiptJSON string
+        Branding    Branding
+        // GradingPending is set while answers wait to be graded by hand.
+        GradingPending bool
+    }{username, score, receipt, receiptJSON, branding, gradingPending}
     templates.ExecuteTemplate(w, "score.html", data)
 }
 
-func adminPage(w http.ResponseWriter, r *http.Request) {
+func adminPage(cfg *Config, w http.ResponseWriter, r *http.Request) {
     mu.Lock()
     defer mu.Unlock()
 
     type AdminData struct {
-        Results    []Result
-        Violations []Violation
-        Students   []Student
-        Questions  []Question
+        Results       []Result
+        Violations    []Violation
+        Students      []Student
+        Questions     []Question
+        MaxViolations int
     }
 
     data := AdminData{
-        Results:    results,
-        Violations: violations,
-        Students:   students,
-        Questions:  questions,
+        Results:       results,
+        Violations:    violations,
+        Students:      students,
+        Questions:     questions,
+        MaxViolations: cfg.MaxViolations,
     }
 
     templates.ExecuteTemplate(w, "add_student.html", data)
@@ -195,8 +374,7 @@ func getQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 
 // --- NEW: API endpoint to delete a question ---
 func deleteQuestionHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    if !allowMethod(w, r, "POST") {
         return
     }
 
@@ -210,9 +388,21 @@ func deleteQuestionHandler(w http.ResponseWriter, r *http.Request) {
     mu.Lock()
     defer mu.Unlock()
 
+    // Pulling a question out from under students needs force=true.
+    if _, attempts := questionUsage(id); attempts > 0 && r.FormValue("force") != "true" {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        json.NewEncoder(w).Encode(map[string]interface{}{"success": "false", "message": "Question is in use by active attempts", "activeAttempts": attempts})
+        return
+    }
+
     for i, q := range questions {
         if q.ID == id {
+            if q.AudioPath != "" {
+                os.Remove(q.AudioPath)
+            }
             questions = append(questions[:i], questions[i+1:]...)
+            saveQuestions()
             w.Header().Set("Content-Type", "application/json")
             json.NewEncoder(w).Encode(map[string]string{"success": "true"})
             return
@@ -222,7 +412,160 @@ func deleteQuestionHandler(w http.ResponseWriter, r *http.Request) {
     http.Error(w, "Question not found", http.StatusNotFound)
 }
 
-func getNextQuestionHandler(w http.ResponseWriter, r *http.Request) {
+// questionUsage returns the IDs of the exams that serve question id and how
+// many active attempts include it. Caller must hold mu.
+func questionUsage(id int) ([]int, int) {
+    examIDs := []int{}
+    for i := range exams {
+        for _, q := range assignedQuestions(&exams[i]) {
+            if q.ID == id {
+                examIDs = append(examIDs, exams[i].ID)
+                break
+            }
+        }
+    }
+    attempts := 0
+    for _, session := range examSessions {
+        if session.Terminated {
+            continue
+        }
+        for _, qid := range session.QuestionIDs {
+            if qid == id {
+                attempts++
+                break
+            }
+        }
+    }
+    return examIDs, attempts
+}
+
+// API endpoint showing what deleting a question would affect
+func questionUsageHandler(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.URL.Query().Get("id"))
+    if err != nil {
+        http.Error(w, "Invalid question ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if findQuestion(id) == nil {
+        http.Error(w, "Question not found", http.StatusNotFound)
+        return
+    }
+    examIDs, attempts := questionUsage(id)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"exams": examIDs, "activeAttempts": attempts})
+}
+
+// questionsBlocked returns the response to send instead of questions while
+// the session can't be served any: terminated, not yet started or waiting
+// on a face re-check. It returns nil when questions may be served.
+// Caller must hold mu.
+func questionsBlocked(cfg *Config, session *ExamSession) interface{} {
+    if _, terminated := checkMonitoringGap(cfg, session); terminated {
+        return map[string]string{"status": "max_violations"}
+    }
+    session.LastActivity = time.Now()
+
+    if session.AcknowledgedAt.IsZero() {
+        instructions, codeRequired := "", false
+        if exam := findExam(session.ExamID); exam != nil {
+            instructions, codeRequired = exam.Instructions, exam.AccessCode != ""
+        }
+        return map[string]interface{}{"status": "not_started", "instructions": instructions, "accessCodeRequired": codeRequired}
+    }
+    if recheckRequired(session, time.Now()) {
+        return map[string]string{"status": "face_recheck"}
+    }
+    return nil
+}
+
+// attemptQuestionIDs returns the questions of username's attempt in served
+// order. Questions added to or removed from the bank later never shift an
+// attempt's positions, with or without a session. Caller must hold mu.
+func attemptQuestionIDs(username string, session *ExamSession) []int {
+    if session != nil {
+        return session.QuestionIDs
+    }
+    ids, ok := userQuestionIDs[username]
+    if !ok {
+        ids = questionIDs(examQuestions(nil))
+        if len(ids) > 0 {
+            userQuestionIDs[username] = ids
+        }
+    }
+    return ids
+}
+
+// nextQuestionIndex returns the position in ids of the next question to
+// serve username, len(ids) once none are left. Caller must hold mu.
+func nextQuestionIndex(username string, session *ExamSession, ids []int) int {
+    index := userQuestionIndex[username]
+
+    // After a reconnect, serve the question that was on screen again unless
+    // it was already answered.
+    if session != nil && session.Resumed {
+        session.Resumed = false
+        if index > 0 {
+            if _, answered := session.Answers[strconv.Itoa(index-1)]; !answered {
+                index--
+            }
+        }
+    }
+
+    // Skip questions deleted from the bank since the attempt began, and
+    // those in sections already submitted.
+    for index < len(ids) && (findQuestion(ids[index]) == nil || (session != nil && sectionLocked(session, index))) {
+        index++
+    }
+    userQuestionIndex[username] = index
+    return index
+}
+
+// serveQuestion marks the question at index as served to username and
+// returns it as the student sees it. Caller must hold mu.
+func serveQuestion(username string, session *ExamSession, exam *Exam, ids []int, index int, lang string) StudentQuestion {
+    q := *findQuestion(ids[index])
+    userQuestionIndex[username] = index + 1
+    if session != nil {
+        if _, served := session.ServedAt[strconv.Itoa(index)]; !served {
+            session.ServedAt[strconv.Itoa(index)] = time.Now()
+        }
+    }
+
+    served := newStudentQuestion(q, lang, 0)
+    served.Index = index
+    served.Labels = optionLabels(exam, q)
+    if session != nil && autoAdvance(session, exam) && q.Time > 0 {
+        // The timer runs from the first time the question was served, so
+        // serving it again after a reconnect only shows what is left.
+        key := strconv.Itoa(index)
+        deadline, ok := session.AnswerDeadlines[key]
+        if !ok {
+            deadline = session.ServedAt[key].Add(time.Duration(q.Time) * time.Second)
+            if session.AnswerDeadlines == nil {
+                session.AnswerDeadlines = make(map[string]time.Time)
+            }
+            session.AnswerDeadlines[key] = deadline
+        }
+        if left := int(time.Until(deadline).Seconds()); left < served.Time {
+            served.Time = left
+        }
+    }
+    var previous *Question
+    if index > 0 {
+        previous = findQuestion(ids[index-1])
+    }
+    if previous == nil || previous.Section != q.Section {
+        served.SectionStart = findSection(exam, q.Section)
+    }
+    return served
+}
+
+func getNextQuestionHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
     username := r.URL.Query().Get("user")
     if username == "" {
         http.Error(w, "User not specified", http.StatusBadRequest)
@@ -232,34 +575,196 @@ func getNextQuestionHandler(w http.ResponseWriter, r *http.Request) {
     mu.Lock()
     defer mu.Unlock()
 
-    if len(questions) == 0 {
+    var exam *Exam
+    session, hasSession := examSessions[username]
+    if hasSession {
+        if blocked := questionsBlocked(cfg, session); blocked != nil {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(blocked)
+            return
+        }
+        exam = findExam(session.ExamID)
+    }
+    ids := attemptQuestionIDs(username, session)
+    if hasSession {
+        expireQuestions(session, exam, time.Now())
+    }
+
+    if len(ids) == 0 {
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(map[string]string{"status": "no_questions"})
         return
     }
 
-    index, ok := userQuestionIndex[username]
-    if !ok {
-        index = 0
-        userQuestionIndex[username] = 0
+    index := nextQuestionIndex(username, session, ids)
+
+    bankLeft := 0
+    if hasSession && !session.BankDeadline.IsZero() {
+        bankLeft = int(bankRemaining(session, time.Now()).Seconds())
     }
 
-    if index >= len(questions) {
+    if index >= len(ids) || (hasSession && !session.BankDeadline.IsZero() && bankLeft <= 0) {
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(map[string]string{"status": "exam_over"})
         return
     }
 
-    currentQuestion := questions[index]
-    userQuestionIndex[username]++
+    lang := r.URL.Query().Get("lang")
+    if lang == "" {
+        lang = studentLanguage(username)
+    }
+
+    served := serveQuestion(username, session, exam, ids, index, lang)
+    served.BankRemaining = bankLeft
+    if cfg.PreloadMedia && index+1 < len(ids) {
+        if next := findQuestion(ids[index+1]); next != nil {
+            served.Preload = questionMediaURLs(*next)
+        }
+    }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(currentQuestion)
+    json.NewEncoder(w).Encode(served)
 }
 
-func addQuestionHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// newStudentQuestion strips the answer from q, using its lang translation
+// when one exists. A non-zero seed shuffles the options deterministically,
+// except where their order is part of the answer.
+func newStudentQuestion(q Question, lang string, seed int64) StudentQuestion {
+    text, source := q.Text, q.Options
+    if t, ok := q.Translations[lang]; ok {
+        text, source = t.Text, t.Options
+    }
+
+    options := make([]string, len(source))
+    copy(options, source)
+
+    if seed != 0 && shuffleable(q) {
+        rng := rand.New(rand.NewSource(seed))
+        rng.Shuffle(len(options), func(i, j int) {
+            options[i], options[j] = options[j], options[i]
+        })
+    }
+
+    return StudentQuestion{
+        ID:       q.ID,
+        Type:     q.Type,
+        Text:     text,
+        Options:  options,
+        Matches:  q.Matches,
+        Time:     q.Time,
+        Section:  q.Section,
+        AudioURL: questionAudioURL(q.AudioPath),
+    }
+}
+
+// shuffleable reports whether q's options may be shown in any order. Ordering
+// and matching answers are graded by option position, so their options are
+// always served as defined.
+func shuffleable(q Question) bool {
+    return q.Type != QuestionOrdering && q.Type != QuestionMatching
+}
+
+// API endpoint showing an admin exactly what a student is served for a question
+func questionPreviewHandler(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.URL.Query().Get("id"))
+    if err != nil {
+        http.Error(w, "Invalid question ID", http.StatusBadRequest)
+        return
+    }
+
+    var seed int64
+    if seedStr := r.URL.Query().Get("seed"); seedStr != "" {
+        seed, err = strconv.ParseInt(seedStr, 10, 64)
+        if err != nil {
+            http.Error(w, "Invalid seed", http.StatusBadRequest)
+            return
+        }
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    for _, q := range questions {
+        if q.ID == id {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(newStudentQuestion(q, r.URL.Query().Get("lang"), seed))
+            return
+        }
+    }
+
+    http.Error(w, "Question not found", http.StatusNotFound)
+}
+
+// studentLanguage returns the student's preferred language. Caller must hold mu.
+func studentLanguage(username string) string {
+    for _, s := range students {
+        if s.Username == username {
+            return s.Language
+        }
+    }
+    return ""
+}
+
+// API endpoint to add, replace or (with empty text) remove a question translation
+func questionTranslationHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    id, err := strconv.Atoi(r.FormValue("id"))
+    if err != nil {
+        http.Error(w, "Invalid question ID", http.StatusBadRequest)
+        return
+    }
+
+    lang := strings.TrimSpace(r.FormValue("lang"))
+    if lang == "" {
+        http.Error(w, "Language not specified", http.StatusBadRequest)
+        return
+    }
+
+    text := r.FormValue("question")
+    var options []string
+    if optionsText := r.FormValue("options"); optionsText != "" {
+        options = strings.Split(optionsText, ",")
+        for i := range options {
+            options[i] = strings.TrimSpace(options[i])
+        }
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    for i := range questions {
+        if questions[i].ID != id {
+            continue
+        }
+
+        if text == "" {
+            delete(questions[i].Translations, lang)
+        } else {
+            if len(options) != len(questions[i].Options) {
+                w.Header().Set("Content-Type", "application/json")
+                json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Translation must have the same number of options"})
+                return
+            }
+            if questions[i].Translations == nil {
+                questions[i].Translations = make(map[string]QuestionText)
+            }
+            questions[i].Translations[lang] = QuestionText{Text: text, Options: options}
+        }
+        saveQuestions()
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+        return
+    }
+
+    http.Error(w, "Question not found", http.StatusNotFound)
+}
+
+func addQuestionHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
@@ -267,6 +772,8 @@ func addQuestionHandler(w http.ResponseWriter, r *http.Request) {
     optionsText := r.FormValue("options")
     answer := r.FormValue("answer")
     timeStr := r.FormValue("time")
+    section := strings.TrimSpace(r.FormValue("section"))
+    questionType := strings.TrimSpace(r.FormValue("type"))
 
     time, err := strconv.Atoi(timeStr)
     if err != nil {
@@ -275,21 +782,94 @@ func addQuestionHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    options := strings.Split(optionsText, ",")
-    for i := range options {
-        options[i] = strings.TrimSpace(options[i])
+    tolerance := 0.0
+    if toleranceStr := r.FormValue("tolerance"); toleranceStr != "" {
+        tolerance, err = strconv.ParseFloat(toleranceStr, 64)
+        if err != nil {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Invalid tolerance value"})
+            return
+        }
+    }
+
+    var options []string
+    if optionsText != "" {
+        options = strings.Split(optionsText, ",")
+        for i := range options {
+            options[i] = strings.TrimSpace(options[i])
+        }
+    }
+    var matches []string
+    if matchesText := r.FormValue("matches"); matchesText != "" {
+        matches = strings.Split(matchesText, ",")
+        for i := range matches {
+            matches[i] = strings.TrimSpace(matches[i])
+        }
+    }
+    partialCredit := r.FormValue("partial_credit") == "true"
+
+    maxPoints := 0
+    if maxPointsStr := r.FormValue("max_points"); maxPointsStr != "" {
+        maxPoints, err = strconv.Atoi(maxPointsStr)
+        if err != nil {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Invalid max points value"})
+            return
+        }
     }
 
-    mu.Lock()
     newQuestion := Question{
-        ID:      questionIDCounter,
-        Text:    questionText,
-        Options: options,
-        Answer:  answer,
-        Time:    time,
+        Type:          questionType,
+        Tolerance:     tolerance,
+        Text:          questionText,
+        Options:       options,
+        Matches:       matches,
+        Answer:        strings.TrimSpace(answer),
+        PartialCredit: partialCredit,
+        Time:          time,
+        Section:       section,
+        ManualGrading: r.FormValue("manual_grading") == "true",
+        Rubric:        strings.TrimSpace(r.FormValue("rubric")),
+        MaxPoints:     maxPoints,
+    }
+    // The key may name the option by its text or its index; it is stored as
+    // the index, like students' answers.
+    if questionType == "" || questionType == QuestionMultipleChoice {
+        if i, ok := matchOption(cfg, newQuestion.Answer, newQuestion); ok {
+            newQuestion.Answer = strconv.Itoa(i)
+        }
+    }
+    if problems := validateQuestion(cfg, newQuestion); len(problems) > 0 {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Invalid question: " + strings.Join(problems, "; ")})
+        return
+    }
+
+    var audio []byte
+    var audioExt string
+    if audioData := r.FormValue("audio"); audioData != "" {
+        audio, audioExt, err = decodeAudio(audioData)
+        if err != nil {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": err.Error()})
+            return
+        }
+    }
+
+    mu.Lock()
+    newQuestion.ID = questionIDCounter
+    if audio != nil {
+        newQuestion.AudioPath, err = saveQuestionAudio(newQuestion.ID, audio, audioExt)
+        if err != nil {
+            mu.Unlock()
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving audio"})
+            return
+        }
     }
     questions = append(questions, newQuestion)
     questionIDCounter++
+    saveQuestions()
     mu.Unlock()
 
     w.Header().Set("Content-Type", "application/json")
@@ -297,7 +877,7 @@ func addQuestionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // --- UPDATED: Redirects admin to the question page ---
-func loginHandler(w http.ResponseWriter, r *http.Request) {
+func loginHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
     if r.Method != "POST" {
         http.Redirect(w, r, "/", http.StatusSeeOther)
         return
@@ -309,6 +889,15 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
     faceValidated := r.FormValue("face_validated")
 
     if role == "student" {
+        // Admins may sign in from anywhere; students only from exam networks.
+        if !examNetworkAllowed(cfg, r) {
+            templates.ExecuteTemplate(w, "login.html", "Exams cannot be taken from this network.")
+            return
+        }
+        if cfg.LoginNotice != "" && r.FormValue("notice_version") != noticeVersion(cfg) {
+            templates.ExecuteTemplate(w, "login.html", "Please read and accept the notice before logging in.")
+            return
+        }
         if pass, ok := studentUser[username]; !ok || pass != password {
             templates.ExecuteTemplate(w, "login.html", "Invalid credentials!")
             return
@@ -319,14 +908,36 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
         mu.Unlock()
 
         if !exists {
-            templates.ExecuteTemplate(w, "login.html", "No reference image found for this student. Please contact the admin.")
-            return
+            if !cfg.SelfEnrollment {
+                templates.ExecuteTemplate(w, "login.html", "No reference image found for this student. Please contact the admin.")
+                return
+            }
+            // First login: the photo just captured becomes the reference face.
+            faceImage := r.FormValue("face_image")
+            if faceImage == "" || faceValidated != "true" {
+                templates.ExecuteTemplate(w, "login.html", "Please capture your face photo to enroll.")
+                return
+            }
+            if message := referenceFaceProblem(cfg, faceImage); message != "" {
+                templates.ExecuteTemplate(w, "login.html", message)
+                return
+            }
+            if !validPathName(username) {
+                templates.ExecuteTemplate(w, "login.html", "Invalid username.")
+                return
+            }
+            if err := saveReferenceFace(username, faceImage); err != nil {
+                templates.ExecuteTemplate(w, "login.html", err.Error())
+                return
+            }
+            log.Printf("%s enrolled a reference face at login", username)
         }
     } else if role == "admin" {
-        if pass, ok := adminUser[username]; !ok || pass != password {
+        if !authenticateAdmin(username, password) {
             templates.ExecuteTemplate(w, "login.html", "Invalid credentials!")
             return
         }
+        startAdminSession(w, username)
         // --- CHANGE: Redirect admin to the question management page ---
         http.Redirect(w, r, "/add-question-page", http.StatusSeeOther)
         return
@@ -338,6 +949,13 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     if role == "student" {
+        mu.Lock()
+        loginIPs[username] = clientIP(cfg, r)
+        if cfg.LoginNotice != "" {
+            recordNoticeAck(cfg, username, clientIP(cfg, r))
+        }
+        mu.Unlock()
+
         http.Redirect(w, r, "/exam?user="+username, http.StatusSeeOther)
     } else {
         templates.ExecuteTemplate(w, "login.html", "Please capture your face photo!")
@@ -345,15 +963,29 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Add student handler
-func addStudentHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func addStudentHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
     username := r.FormValue("username")
     password := r.FormValue("password")
     faceImage := r.FormValue("face_image")
+    language := strings.TrimSpace(r.FormValue("language"))
+
+    if problems := passwordProblems(cfg, password); len(problems) > 0 {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Password " + strings.Join(problems, "; ")})
+        return
+    }
+
+    if faceImage != "" {
+        if message := referenceFaceProblem(cfg, faceImage); message != "" {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": message})
+            return
+        }
+    }
 
     mu.Lock()
     if _, exists := studentUser[username]; exists {
@@ -364,7 +996,7 @@ func addStudentHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     studentUser[username] = password
-    students = append(students, Student{Username: username})
+    students = append(students, Student{Username: username, Language: language})
     mu.Unlock()
 
     if faceImage == "" {
@@ -373,40 +1005,61 @@ func addStudentHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    parts := strings.Split(faceImage, ",")
-    if len(parts) != 2 {
+    if err := saveReferenceFace(username, faceImage); err != nil {
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Invalid face image format"})
+        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": err.Error()})
         return
     }
 
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Student added successfully"})
+}
+
+// referenceFaceProblem returns why faceImage, a data URL, can't be used as a
+// reference face, or "" if it can. It must show exactly one face or matching
+// fails later.
+func referenceFaceProblem(cfg *Config, faceImage string) string {
+    if cfg.SkipReferenceFaceCheck {
+        return ""
+    }
+    count, err := countFaces(cfg, faceImage)
+    switch {
+    case err != nil:
+        return "Could not check the face image; the face service may be down"
+    case count == 0:
+        return "No face found in the face image"
+    case count > 1:
+        return "The face image must show exactly one face"
+    }
+    return ""
+}
+
+// saveReferenceFace stores faceImage, a data URL, as username's reference face.
+func saveReferenceFace(username, faceImage string) error {
+    parts := strings.Split(faceImage, ",")
+    if len(parts) != 2 {
+        return fmt.Errorf("Invalid face image format")
+    }
+
     decoded, err := base64.StdEncoding.DecodeString(parts[1])
     if err != nil {
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error decoding face image"})
-        return
+        return fmt.Errorf("Error decoding face image")
     }
 
     referenceFacePath := filepath.Join("reference_faces", username+".jpg")
-    err = ioutil.WriteFile(referenceFacePath, decoded, 0644)
-    if err != nil {
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(map[string]string{"success": "false", "message": "Error saving face image"})
-        return
+    if err := ioutil.WriteFile(referenceFacePath, decoded, 0644); err != nil {
+        return fmt.Errorf("Error saving face image")
     }
 
     mu.Lock()
     userReferenceFaces[username] = referenceFacePath
     mu.Unlock()
-
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Student added successfully"})
+    return nil
 }
 
 // Delete student handler
 func deleteStudentHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+    if !allowMethod(w, r, "POST") {
         return
     }
 
@@ -433,6 +1086,28 @@ func deleteStudentHandler(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Student deleted successfully"})
 }
 
+// API endpoint listing the students who have no reference face yet, sorted
+// by username. Unless self enrollment is on they can't log in until one is
+// uploaded.
+func unenrolledStudentsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    mu.Lock()
+    unenrolled := []string{}
+    for username := range studentUser {
+        if _, ok := userReferenceFaces[username]; !ok {
+            unenrolled = append(unenrolled, username)
+        }
+    }
+    mu.Unlock()
+    sort.Strings(unenrolled)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"students": unenrolled, "selfEnrollment": cfg.SelfEnrollment})
+}
+
 // Serve reference image
 func serveReferenceImage(w http.ResponseWriter, r *http.Request) {
     path := strings.TrimPrefix(r.URL.Path, "/reference-images/")
@@ -456,9 +1131,8 @@ func serveReferenceImage(w http.ResponseWriter, r *http.Request) {
 }
 
 // Validate face in the captured image
-func validateFaceHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        w.WriteHeader(http.StatusBadRequest)
+func validateFaceHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
@@ -482,38 +1156,64 @@ func validateFaceHandler(w http.ResponseWriter, r *http.Request) {
             return
         }
 
-        resp, err := http.PostForm("http://localhost:5000/validate-face", url.Values{
+        responseStr, err := postFaceService(cfg, "/validate-face", url.Values{
             "image":          {imgData},
             "reference_face": {referenceFacePath},
         })
         if err != nil {
-            w.WriteHeader(http.StatusInternalServerError)
-            w.Write([]byte("ERROR"))
+            faceServiceError(cfg, w, err)
             return
         }
-        defer resp.Body.Close()
+        switch responseStr {
+        case "FACE_MATCH", "NO_FACE_MATCH", "NO_FACE_DETECTED":
+        default:
+            if !unknownFaceResponse(cfg, "/validate-face", responseStr) {
+                faceServiceError(cfg, w, errFaceServiceUnknown)
+                return
+            }
+        }
+        matched := responseStr == "FACE_MATCH"
 
-        body, _ := ioutil.ReadAll(resp.Body)
-        responseStr := string(body)
+        // A validation during the exam may be settling an identity re-check.
+        mu.Lock()
+        session, inExam := examSessions[username]
+        pending := inExam && session.RecheckPending
+        mu.Unlock()
+        if pending {
+            imagePath := ""
+            if !matched {
+                imagePath = saveCapture(username, imgData)
+            }
+            mu.Lock()
+            terminated := session.RecheckPending && finishRecheck(cfg, session, matched, imagePath, time.Now())
+            mu.Unlock()
+            if terminated {
+                w.Write([]byte("MAX_VIOLATIONS"))
+                return
+            }
+        }
 
-        if responseStr == "FACE_MATCH" {
+        if matched {
             w.Write([]byte("FACE_MATCH"))
         } else {
             w.Write([]byte("NO_FACE_MATCH"))
         }
     } else {
-        resp, err := http.PostForm("http://localhost:5000/validate-face", url.Values{
+        responseStr, err := postFaceService(cfg, "/validate-face", url.Values{
             "image": {imgData},
         })
         if err != nil {
-            w.WriteHeader(http.StatusInternalServerError)
-            w.Write([]byte("ERROR"))
+            faceServiceError(cfg, w, err)
             return
         }
-        defer resp.Body.Close()
-
-        body, _ := ioutil.ReadAll(resp.Body)
-        responseStr := string(body)
+        switch responseStr {
+        case "FACE_DETECTED", "NO_FACE_DETECTED":
+        default:
+            if !unknownFaceResponse(cfg, "/validate-face", responseStr) {
+                faceServiceError(cfg, w, errFaceServiceUnknown)
+                return
+            }
+        }
 
         if responseStr == "FACE_DETECTED" {
             w.Write([]byte("FACE_DETECTED"))
@@ -524,9 +1224,8 @@ func validateFaceHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Forward captured data to Python OpenCV service
-func captureHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        w.WriteHeader(http.StatusBadRequest)
+func captureHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
@@ -536,29 +1235,36 @@ func captureHandler(w http.ResponseWriter, r *http.Request) {
 
     mu.Lock()
     referenceFacePath, exists := userReferenceFaces[username]
+    if session, ok := examSessions[username]; ok {
+        session.LastCapture = time.Now()
+        session.LastActivity = session.LastCapture
+    }
+    // Frames that come too fast still count as activity but are not analysed.
+    throttled := captureThrottled(cfg, username, time.Now())
     mu.Unlock()
 
+    if throttled {
+        w.WriteHeader(http.StatusTooManyRequests)
+        w.Write([]byte("THROTTLED"))
+        return
+    }
+
     if !exists {
         w.WriteHeader(http.StatusInternalServerError)
         w.Write([]byte("ERROR: No reference face found for user"))
         return
     }
 
-    resp, err := http.PostForm("http://localhost:5000/capture", url.Values{
+    responseStr, err := postFaceService(cfg, "/capture", url.Values{
         "image":           {imgData},
         "username":        {username},
         "noise_violation": {noiseViolation},
         "reference_face":  {referenceFacePath},
     })
     if err != nil {
-        w.WriteHeader(http.StatusInternalServerError)
-        w.Write([]byte("ERROR"))
+        faceServiceError(cfg, w, err)
         return
     }
-    defer resp.Body.Close()
-    body, _ := ioutil.ReadAll(resp.Body)
-
-    responseStr := string(body)
 
     if responseStr == "FACE_MISMATCH" {
         w.Write([]byte("FACE_MISMATCH"))
@@ -571,151 +1277,90 @@ func captureHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     if strings.HasPrefix(responseStr, "VIOLATION:") {
+        // The service reports VIOLATION:<TYPE>[:<DETAIL>]:<count>. Its count is
+        // ignored; the total is kept here so weights and grace windows apply.
         respParts := strings.Split(responseStr, ":")
         if len(respParts) >= 3 {
-            countStr := respParts[len(respParts)-1]
-            count := 0
-            fmt.Sscanf(countStr, "%d", &count)
+            violationType := respParts[1]
+            detail := strings.Join(respParts[2:len(respParts)-1], ":")
 
             mu.Lock()
-            found := false
-            for i, v := range violations {
-                if v.Username == username {
-                    if count > violations[i].Count {
-                        violations[i].Count = count
-                    }
-                    found = true
-
-                    if violations[i].Count >= 10 {
-                        mu.Unlock()
-                        w.Write([]byte("MAX_VIOLATIONS"))
-                        return
-                    }
-                    break
-                }
-            }
-
-            if !found {
-                violations = append(violations, Violation{Username: username, Count: count})
-            }
+            enabled := violationEnabled(username, violationType)
             mu.Unlock()
+            if !enabled {
+                w.Write([]byte("OK"))
+                return
+            }
 
-            w.Write([]byte(responseStr))
-            return
-        }
-    }
-
-    w.Write(body)
-}
-
-// Handle fullscreen violation
-func fullscreenViolationHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        w.WriteHeader(http.StatusBadRequest)
-        return
-    }
+            imagePath := saveCapture(username, imgData)
 
-    username := r.FormValue("username")
+            mu.Lock()
+            count, terminated := recordViolation(cfg, username, violationType, detail, imagePath)
+            mu.Unlock()
 
-    mu.Lock()
-    found := false
-    for i, v := range violations {
-        if v.Username == username {
-            violations[i].Count++
-            found = true
-
-            if violations[i].Count >= 10 {
-                mu.Unlock()
+            if terminated {
                 w.Write([]byte("MAX_VIOLATIONS"))
                 return
             }
 
-            w.Write([]byte(fmt.Sprintf("VIOLATION:FULLSCREEN_VIOLATION:%d", violations[i].Count)))
-            mu.Unlock()
+            respParts[len(respParts)-1] = strconv.Itoa(count)
+            w.Write([]byte(strings.Join(respParts, ":")))
             return
         }
     }
 
-    if !found {
-        violations = append(violations, Violation{Username: username, Count: 1})
-        w.Write([]byte(fmt.Sprintf("VIOLATION:FULLSCREEN_VIOLATION:1")))
+    switch responseStr {
+    case "OK", "MAX_VIOLATIONS", "ERROR":
+        w.Write([]byte(responseStr))
+    default:
+        // A soft failure skips the frame as if it had been clean.
+        if !unknownFaceResponse(cfg, "/capture", responseStr) {
+            faceServiceError(cfg, w, errFaceServiceUnknown)
+            return
+        }
+        w.Write([]byte("OK"))
     }
-    mu.Unlock()
 }
 
-// Handle tab change violation
-func tabChangeViolationHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        w.WriteHeader(http.StatusBadRequest)
+// Handle fullscreen violation
+func fullscreenViolationHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
-    username := r.FormValue("username")
-
-    mu.Lock()
-    found := false
-    for i, v := range violations {
-        if v.Username == username {
-            violations[i].Count++
-            found = true
-
-            if violations[i].Count >= 10 {
-                mu.Unlock()
-                w.Write([]byte("MAX_VIOLATIONS"))
-                return
-            }
+    writeViolation(cfg, w, r.FormValue("username"), "FULLSCREEN_VIOLATION", 0)
+}
 
-            w.Write([]byte(fmt.Sprintf("VIOLATION:TAB_CHANGE_VIOLATION:%d", violations[i].Count)))
-            mu.Unlock()
-            return
-        }
+// Handle tab change violation
+func tabChangeViolationHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
     }
 
-    if !found {
-        violations = append(violations, Violation{Username: username, Count: 1})
-        w.Write([]byte(fmt.Sprintf("VIOLATION:TAB_CHANGE_VIOLATION:1")))
+    duration, ok := focusLossDuration(r)
+    if !ok {
+        http.Error(w, "Invalid duration", http.StatusBadRequest)
+        return
     }
-    mu.Unlock()
+    writeViolation(cfg, w, r.FormValue("username"), "TAB_CHANGE_VIOLATION", duration)
 }
 
 // Handle window change violation
-func windowChangeViolationHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        w.WriteHeader(http.StatusBadRequest)
+func windowChangeViolationHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
-    username := r.FormValue("username")
-
-    mu.Lock()
-    found := false
-    for i, v := range violations {
-        if v.Username == username {
-            violations[i].Count++
-            found = true
-
-            if violations[i].Count >= 10 {
-                mu.Unlock()
-                w.Write([]byte("MAX_VIOLATIONS"))
-                return
-            }
-
-            w.Write([]byte(fmt.Sprintf("VIOLATION:WINDOW_CHANGE_VIOLATION:%d", violations[i].Count)))
-            mu.Unlock()
-            return
-        }
-    }
-
-    if !found {
-        violations = append(violations, Violation{Username: username, Count: 1})
-        w.Write([]byte(fmt.Sprintf("VIOLATION:WINDOW_CHANGE_VIOLATION:1")))
+    duration, ok := focusLossDuration(r)
+    if !ok {
+        http.Error(w, "Invalid duration", http.StatusBadRequest)
+        return
     }
-    mu.Unlock()
+    writeViolation(cfg, w, r.FormValue("username"), "WINDOW_CHANGE_VIOLATION", duration)
 }
 
-func submitHandler(w http.ResponseWriter, r *http.Request) {
-    if r.Method != "POST" {
-        w.WriteHeader(http.StatusBadRequest)
+func submitHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
         return
     }
 
@@ -735,23 +1380,75 @@ func submitHandler(w http.ResponseWriter, r *http.Request) {
     userAnswers := sub.Answers
 
     mu.Lock()
-    correctAnswers := make(map[string]string)
-    for i, q := range questions {
-        correctAnswers[strconv.Itoa(i)] = q.Answer
+    // Grade the answers saved during the exam, updated by the final submission.
+    answers := make(map[string]string)
+    lateSubmission := false
+    session, hasSession := examSessions[username]
+    // A session stopped at the violation limit is graded on the answers it
+    // saved before it was stopped; the final submission is ignored.
+    terminated := hasSession && session.Terminated
+    // Submitting before the exam's minimum duration is refused, unless the
+    // time bank has already run out or the session was terminated.
+    if hasSession && !terminated && (session.BankDeadline.IsZero() || bankRemaining(session, time.Now()) > 0) {
+        if allowedAt := submitAllowedAt(session); time.Now().Before(allowedAt) {
+            mu.Unlock()
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(http.StatusTooEarly)
+            json.NewEncoder(w).Encode(map[string]interface{}{
+                "success":         false,
+                "message":         "This exam cannot be submitted yet",
+                "submitAllowedAt": allowedAt,
+                "waitSeconds":     int(time.Until(allowedAt).Seconds()) + 1,
+            })
+            return
+        }
     }
-
-    score := 0
-    for qIndex, userAnswer := range userAnswers {
-        if correctAnswer, ok := correctAnswers[qIndex]; ok && userAnswer == correctAnswer {
-            score++
+    if hasSession {
+        for k, v := range session.Answers {
+            answers[k] = v
         }
+        // Answers changed after the time bank and its grace ran out are not
+        // counted. Ones within the grace are, and the result says so.
+        lateSubmission, session.SubmittedInGrace = submissionTiming(cfg, session, time.Now())
     }
-
-    results = append(results, Result{Username: username, Score: score})
+    if !lateSubmission && !terminated {
+        for k, v := range userAnswers {
+            if hasSession {
+                if answerTimeUp(session, k, time.Now()) && answers[k] != v {
+                    continue // Changed after its batch deadline
+                }
+                if i, err := strconv.Atoi(k); err == nil {
+                    if sectionLocked(session, i) {
+                        continue // Graded when its section was submitted
+                    }
+                    if q, ok := servedQuestion(session, i); ok {
+                        v = submittedAnswer(cfg, findExam(session.ExamID), q, v)
+                    }
+                }
+            } else if i, err := strconv.Atoi(k); err == nil {
+                if ids := attemptQuestionIDs(username, nil); i >= 0 && i < len(ids) {
+                    if q := findQuestion(ids[i]); q != nil {
+                        v = submittedAnswer(cfg, nil, *q, v)
+                    }
+                }
+            }
+            if hasSession && answers[k] != v {
+                recordAnswerTime(session, k, time.Now())
+                recordAnswerChange(session, k, v, time.Now())
+            }
+            answers[k] = v
+        }
+    }
+    endReason := EndSubmitted
+    if terminated {
+        endReason = EndTerminated
+    }
+    result := finishAttempt(cfg, username, answers, endReason, clientIP(cfg, r))
+    receipt := newReceipt(cfg, result)
     mu.Unlock()
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "score": score})
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "score": result.Score, "sections": result.SectionScores, "gradingPending": result.GradingPending, "receipt": receipt})
 }
 
 func ServeadminloginPage(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,175 @@
+package main
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// testConfig is the configuration the tests serve with. resetState puts
+// back the defaults.
+var testConfig = &Config{}
+
+// TestMain runs the tests from a scratch directory, since handlers persist
+// state under data/ relative to the working directory.
+func TestMain(m *testing.M) {
+    dir, err := ioutil.TempDir("", "proctor-test")
+    if err != nil {
+        log.Fatal(err)
+    }
+    if err := os.Chdir(dir); err != nil {
+        log.Fatal(err)
+    }
+    log.SetOutput(ioutil.Discard)
+    *testConfig = defaultConfig()
+    code := m.Run()
+    os.RemoveAll(dir)
+    os.Exit(code)
+}
+
+// resetState clears the server's state and fills the bank with n multiple
+// choice questions, each answered by option 0, served by exam 1.
+func resetState(t *testing.T, n int) {
+    t.Helper()
+    mu.Lock()
+    defer mu.Unlock()
+
+    *testConfig = defaultConfig()
+    questions = nil
+    for i := 1; i <= n; i++ {
+        questions = append(questions, Question{ID: i, Text: "Question", Options: []string{"a", "b"}, Answer: "0", Time: 30})
+    }
+    questionIDCounter = n + 1
+    exams = []Exam{{ID: 1, Title: "Exam"}}
+    examIDCounter = 2
+    examSessions = make(map[string]*ExamSession)
+    userQuestionIndex = make(map[string]int)
+    userQuestionIDs = make(map[string][]int)
+    results = nil
+    violations = nil
+    violationEvents = nil
+}
+
+// startAttempt opens and starts an exam session for username.
+func startAttempt(t *testing.T, username string, examID int) {
+    t.Helper()
+    mu.Lock()
+    defer mu.Unlock()
+    acknowledgeStart(startExamSession(username, examID), time.Now())
+}
+
+// serve runs handler on a request to target, with form as a POST body when
+// it is not nil.
+func serve(handler http.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+    r := httptest.NewRequest("GET", target, nil)
+    if form != nil {
+        r = httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+        r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    }
+    w := httptest.NewRecorder()
+    handler(w, r)
+    return w
+}
+
+// nextQuestion fetches username's next question, failing the test unless
+// one is served.
+func nextQuestion(t *testing.T, username string) StudentQuestion {
+    t.Helper()
+    w := serve(withConfig(testConfig, getNextQuestionHandler), "/get-next-question?user="+url.QueryEscape(username), nil)
+    var q StudentQuestion
+    if err := json.Unmarshal(w.Body.Bytes(), &q); err != nil || q.ID == 0 {
+        t.Fatalf("no question served: %d %s", w.Code, w.Body.String())
+    }
+    return q
+}
+
+// submit posts username's final answers and returns the decoded response.
+func submit(t *testing.T, username string, answers map[string]string) map[string]interface{} {
+    t.Helper()
+    body, _ := json.Marshal(map[string]interface{}{"username": username, "answers": answers})
+    r := httptest.NewRequest("POST", "/submit", strings.NewReader(string(body)))
+    r.Header.Set("Content-Type", "application/json")
+    w := httptest.NewRecorder()
+    submitHandler(testConfig, w, r)
+    var resp map[string]interface{}
+    if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+        t.Fatalf("submit: %d %s", w.Code, w.Body.String())
+    }
+    return resp
+}
+
+func TestLoadTemplatesMissing(t *testing.T) {
+    dir, err := ioutil.TempDir("", "proctor-templates")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    pages := filepath.Join(dir, "templates")
+
+    // A missing directory is created, and having no pages is an error
+    // rather than a panic.
+    if _, err := loadTemplates(pages); err == nil {
+        t.Fatal("no error with no templates")
+    }
+    if info, err := os.Stat(pages); err != nil || !info.IsDir() {
+        t.Fatalf("templates directory not created: %v", err)
+    }
+
+    if err := ioutil.WriteFile(filepath.Join(pages, "login.html"), []byte("Log in"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    tmpl, err := loadTemplates(pages)
+    if err != nil {
+        t.Fatalf("loading a page: %v", err)
+    }
+    if tmpl.Lookup("login.html") == nil {
+        t.Error("login.html was not parsed")
+    }
+}
+
+func TestShuffleKeepsOrderingAndMatching(t *testing.T) {
+    options := []string{"first", "second", "third", "fourth", "fifth"}
+    ordering := Question{ID: 1, Type: QuestionOrdering, Options: options, Answer: "0,1,2,3,4"}
+    matching := Question{ID: 2, Type: QuestionMatching, Options: options, Matches: []string{"1", "2", "3", "4", "5"}, Answer: "0,1,2,3,4"}
+    choice := Question{ID: 3, Options: options, Answer: "0"}
+
+    shuffled := false
+    for seed := int64(1); seed <= 20; seed++ {
+        for _, q := range []Question{ordering, matching} {
+            served := newStudentQuestion(q, "", seed)
+            if strings.Join(served.Options, ",") != strings.Join(options, ",") {
+                t.Fatalf("%s question shuffled with seed %d: %v", q.Type, seed, served.Options)
+            }
+            // Positions in the served order grade against the key.
+            if !answerCorrect(testConfig, q, "0,1,2,3,4") {
+                t.Fatalf("%s question: the served order was not correct", q.Type)
+            }
+        }
+        served := newStudentQuestion(choice, "", seed)
+        shuffled = shuffled || strings.Join(served.Options, ",") != strings.Join(options, ",")
+    }
+    if !shuffled {
+        t.Error("multiple choice options were never shuffled")
+    }
+
+    resetState(t, 0)
+    mu.Lock()
+    questions = []Question{ordering}
+    mu.Unlock()
+    w := serve(questionPreviewHandler, "/question-preview?id=1&seed=7", nil)
+    var served StudentQuestion
+    if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+        t.Fatalf("preview: %d %s", w.Code, w.Body.String())
+    }
+    if strings.Join(served.Options, ",") != strings.Join(options, ",") {
+        t.Errorf("preview shuffled an ordering question: %v", served.Options)
+    }
+}
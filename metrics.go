@@ -0,0 +1,47 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "sync/atomic"
+)
+
+// breakerSnapshot returns the face service breaker's state, its current run
+// of failures and how many times it has opened.
+func breakerSnapshot() (string, int, int) {
+    faceBreaker.Lock()
+    defer faceBreaker.Unlock()
+    return faceBreaker.State, faceBreaker.Failures, faceBreaker.Opened
+}
+
+// API endpoint reporting runtime counters for monitoring the server.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    state, failures, opened := breakerSnapshot()
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "faceServiceInFlight":     len(faceSlots),
+        "faceServiceLimit":        cap(faceSlots),
+        "faceServiceRejected":     atomic.LoadInt64(&faceServiceRejected),
+        "faceServiceUnknown":      atomic.LoadInt64(&faceServiceUnknown),
+        "faceServiceBreaker":      state,
+        "faceServiceFailures":     failures,
+        "faceServiceBreakerOpens": opened,
+    })
+}
+
+// Health check for load balancers and monitoring. The server is up whenever
+// it answers; an open face service breaker is reported as degraded.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+    state, _, _ := breakerSnapshot()
+    status := "ok"
+    if state != BreakerClosed {
+        status = "degraded"
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"status": status, "faceService": state})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "encoding/json"
+    "net"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Last login IP per student, copied onto their result at submission
+var loginIPs = make(map[string]string)
+
+// parseNetworks parses IPs and CIDRs; a bare IP becomes a single-host network.
+func parseNetworks(entries []string) []*net.IPNet {
+    var networks []*net.IPNet
+    for _, entry := range entries {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            if ip := net.ParseIP(entry); ip != nil {
+                bits := 32
+                if ip.To4() == nil {
+                    bits = 128
+                }
+                entry = entry + "/" + strconv.Itoa(bits)
+            }
+        }
+        if _, network, err := net.ParseCIDR(entry); err == nil {
+            networks = append(networks, network)
+        }
+    }
+    return networks
+}
+
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+    for _, network := range networks {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// clientIP returns the address of the client behind r. X-Forwarded-For is only
+// honored when the connection comes from a configured trusted proxy, and then
+// the nearest address not belonging to a trusted proxy is used.
+func clientIP(cfg *Config, r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+
+    trusted := parseNetworks(cfg.TrustedProxies)
+    ip := net.ParseIP(host)
+    if ip == nil || !inNetworks(ip, trusted) {
+        return host
+    }
+
+    hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+    for i := len(hops) - 1; i >= 0; i-- {
+        hop := net.ParseIP(strings.TrimSpace(hops[i]))
+        if hop == nil {
+            break
+        }
+        host = hop.String()
+        if !inNetworks(hop, trusted) {
+            break
+        }
+    }
+    return host
+}
+
+// examNetworkAllowed reports whether the client behind r may log in as a
+// student and take exams under Config.ExamAllowedNetworks and
+// Config.ExamDeniedNetworks.
+func examNetworkAllowed(cfg *Config, r *http.Request) bool {
+    ip := net.ParseIP(clientIP(cfg, r))
+    if ip == nil {
+        return len(cfg.ExamAllowedNetworks) == 0 && len(cfg.ExamDeniedNetworks) == 0
+    }
+    if inNetworks(ip, parseNetworks(cfg.ExamDeniedNetworks)) {
+        return false
+    }
+    allowed := parseNetworks(cfg.ExamAllowedNetworks)
+    return len(allowed) == 0 || inNetworks(ip, allowed)
+}
+
+// requireExamNetwork returns middleware only letting through clients on an
+// allowed exam network.
+func requireExamNetwork(cfg *Config) middleware {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            if !examNetworkAllowed(cfg, r) {
+                http.Error(w, "Exams cannot be taken from this network", http.StatusForbidden)
+                return
+            }
+            next(w, r)
+        }
+    }
+}
+
+// API endpoint listing the IPs recorded for each of a student's attempts
+func sessionIPsHandler(w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    type attemptIPs struct {
+        ExamID      int
+        SubmittedAt time.Time
+        LoginIP     string
+        SubmitIP    string
+    }
+
+    attempts := []attemptIPs{}
+    for _, res := range results {
+        if res.Username == username {
+            attempts = append(attempts, attemptIPs{
+                ExamID:      res.ExamID,
+                SubmittedAt: res.SubmittedAt,
+                LoginIP:     res.LoginIP,
+                SubmitIP:    res.SubmitIP,
+            })
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "username":    username,
+        "lastLoginIP": loginIPs[username],
+        "attempts":    attempts,
+    })
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "log"
+    "net/http"
+    "os"
+    "time"
+)
+
+const noticeAcksFile = "notice_acks.json"
+
+// NoticeAck records a student accepting the login notice.
+type NoticeAck struct {
+    Username string
+    Version  string // noticeVersion of the text that was accepted
+    IP       string
+    Time     time.Time
+}
+
+// Every acknowledgment of the login notice, kept for compliance
+var noticeAcks []NoticeAck
+
+// noticeVersion identifies the current login notice text, so an
+// acknowledgment shows which wording was accepted.
+func noticeVersion(cfg *Config) string {
+    sum := sha256.Sum256([]byte(cfg.LoginNotice))
+    return hex.EncodeToString(sum[:6])
+}
+
+// loadNoticeAcks reads the persisted notice acknowledgments.
+func loadNoticeAcks() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    if err := loadJSON(noticeAcksFile, &noticeAcks); err != nil && !os.IsNotExist(err) {
+        log.Fatalf("loading %s: %v", noticeAcksFile, err)
+    }
+}
+
+// recordNoticeAck stores username's acceptance of the current notice.
+// Caller must hold mu.
+func recordNoticeAck(cfg *Config, username, ip string) {
+    noticeAcks = append(noticeAcks, NoticeAck{
+        Username: username,
+        Version:  noticeVersion(cfg),
+        IP:       ip,
+        Time:     time.Now(),
+    })
+    if err := saveJSON(noticeAcksFile, noticeAcks); err != nil {
+        log.Printf("saving %s: %v", noticeAcksFile, err)
+    }
+}
+
+// API endpoint serving the notice students must accept before logging in.
+// The notice may contain HTML; it is disabled while Config.LoginNotice is
+// empty.
+func noticeHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    if cfg.LoginNotice == "" {
+        json.NewEncoder(w).Encode(map[string]interface{}{"enabled": false})
+        return
+    }
+    json.NewEncoder(w).Encode(map[string]interface{}{"enabled": true, "notice": cfg.LoginNotice, "version": noticeVersion(cfg)})
+}
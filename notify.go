@@ -0,0 +1,265 @@
+package main
+
+import (
+    "crypto/tls"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "net/smtp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type emailDelivery struct {
+    To       string
+    Subject  string
+    Body     string
+    Attempts int
+}
+
+var emailQueue = make(chan emailDelivery, 100)
+
+// emailTimeout bounds a whole SMTP exchange, so a mail server that stops
+// answering can't hold up the worker or a test notification.
+var emailTimeout = 30 * time.Second
+
+// enqueueEmail queues a plain text email without blocking the caller.
+func enqueueEmail(to, subject, body string) {
+    select {
+    case emailQueue <- emailDelivery{To: to, Subject: subject, Body: body}:
+    default:
+        log.Printf("email: queue full, dropping %q to %s", subject, to)
+    }
+}
+
+func sendEmail(cfg *Config, d emailDelivery) error {
+    addr := net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port))
+    var auth smtp.Auth
+    if cfg.SMTP.Username != "" {
+        auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+    }
+    msg := "From: " + cfg.SMTP.From + "\r\n" +
+        "To: " + d.To + "\r\n" +
+        "Subject: " + d.Subject + "\r\n" +
+        "Content-Type: text/plain; charset=utf-8\r\n" +
+        "\r\n" + strings.ReplaceAll(d.Body, "\n", "\r\n")
+    return sendMail(addr, auth, cfg.SMTP.From, d.To, []byte(msg))
+}
+
+// sendMail is smtp.SendMail with a deadline of emailTimeout on the
+// connection.
+func sendMail(addr string, auth smtp.Auth, from, to string, msg []byte) error {
+    conn, err := net.DialTimeout("tcp", addr, emailTimeout)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    if err := conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+        return err
+    }
+
+    host, _, _ := net.SplitHostPort(addr)
+    c, err := smtp.NewClient(conn, host)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    if ok, _ := c.Extension("STARTTLS"); ok {
+        if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+            return err
+        }
+    }
+    if auth != nil {
+        if ok, _ := c.Extension("AUTH"); !ok {
+            return errors.New("smtp: server doesn't support AUTH")
+        }
+        if err := c.Auth(auth); err != nil {
+            return err
+        }
+    }
+    if err := c.Mail(from); err != nil {
+        return err
+    }
+    if err := c.Rcpt(to); err != nil {
+        return err
+    }
+    body, err := c.Data()
+    if err != nil {
+        return err
+    }
+    if _, err := body.Write(msg); err != nil {
+        return err
+    }
+    if err := body.Close(); err != nil {
+        return err
+    }
+    return c.Quit()
+}
+
+// runEmailWorker sends queued emails, retrying failures with the same
+// backoff as webhooks.
+func runEmailWorker(cfg *Config) {
+    for d := range emailQueue {
+        err := sendEmail(cfg, d)
+        if err == nil {
+            continue
+        }
+
+        d.Attempts++
+        if d.Attempts >= cfg.EmailMaxAttempts {
+            log.Printf("email: giving up on %q to %s after %d attempts: %v", d.Subject, d.To, d.Attempts, err)
+            continue
+        }
+
+        backoff := webhookBaseBackoff << uint(d.Attempts-1)
+        if backoff > webhookMaxBackoff {
+            backoff = webhookMaxBackoff
+        }
+        log.Printf("email: sending %q to %s failed (attempt %d), retrying in %s: %v", d.Subject, d.To, d.Attempts, backoff, err)
+
+        retry := d
+        time.AfterFunc(backoff, func() {
+            select {
+            case emailQueue <- retry:
+            default:
+                log.Printf("email: queue full, dropping retry of %q to %s", retry.Subject, retry.To)
+            }
+        })
+    }
+}
+
+// notifyMaxViolations emails Config.NotifyEmail that username's exam was
+// terminated, with a count of their violations by type. Caller must hold mu.
+func notifyMaxViolations(cfg *Config, username string, examID, count int) {
+    if cfg.NotifyEmail == "" {
+        return
+    }
+
+    exam := findExam(examID)
+    examTitle := "no exam"
+    if exam != nil {
+        examTitle = exam.Title
+    }
+    byType := make(map[string]int)
+    for _, e := range violationEvents {
+        if e.Username == username {
+            byType[e.Type]++
+        }
+    }
+    types := make([]string, 0, len(byType))
+    for violationType := range byType {
+        types = append(types, violationType)
+    }
+    sort.Strings(types)
+
+    var body strings.Builder
+    fmt.Fprintf(&body, "%s reached the violation limit and their exam was terminated.\n\n", username)
+    fmt.Fprintf(&body, "Exam: %s (%d)\n", examTitle, examID)
+    fmt.Fprintf(&body, "Violation total: %d of %d\n\n", count, maxViolations(cfg, exam))
+    for _, violationType := range types {
+        fmt.Fprintf(&body, "  %s: %d\n", violationType, byType[violationType])
+    }
+
+    enqueueEmail(cfg.NotifyEmail, "Exam terminated: "+username, body.String())
+}
+
+// testNotificationInterval is how often each channel may be tested.
+const testNotificationInterval = 30 * time.Second
+
+// When each notification channel was last tested
+var lastNotificationTest = make(map[string]time.Time)
+
+// API endpoint sending a test message through ?channel=email or webhook and
+// reporting whether it went through, so settings can be checked before an
+// exam. The message is sent at once, not queued, so the error is the real
+// one. Every configured webhook gets the test. Each channel can be tested
+// once per testNotificationInterval.
+func testNotificationHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    type delivery struct {
+        Name    string `json:"name"`
+        Target  string `json:"target"`
+        Success bool   `json:"success"`
+        Error   string `json:"error,omitempty"`
+    }
+
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    channel := r.URL.Query().Get("channel")
+    var webhooks []webhookDelivery
+    var webhookNames []string
+    switch channel {
+    case "email":
+        if cfg.NotifyEmail == "" || cfg.SMTP.Host == "" {
+            http.Error(w, "Email notifications are not configured", http.StatusBadRequest)
+            return
+        }
+    case "webhook":
+        if cfg.ViolationWebhookURL != "" {
+            webhooks = append(webhooks, webhookDelivery{URL: cfg.ViolationWebhookURL, Secret: cfg.WebhookSecret})
+            webhookNames = append(webhookNames, "violation webhook")
+        }
+        if cfg.CompletionWebhookURL != "" {
+            webhooks = append(webhooks, webhookDelivery{URL: cfg.CompletionWebhookURL, Secret: completionWebhookSecret(cfg)})
+            webhookNames = append(webhookNames, "completion webhook")
+        }
+        if len(webhooks) == 0 {
+            http.Error(w, "No webhooks are configured", http.StatusBadRequest)
+            return
+        }
+    default:
+        http.Error(w, "Channel must be email or webhook", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+    now := time.Now()
+
+    mu.Lock()
+    if wait := testNotificationInterval - now.Sub(lastNotificationTest[channel]); wait > 0 {
+        mu.Unlock()
+        w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+        http.Error(w, "A test was sent recently; try again shortly", http.StatusTooManyRequests)
+        return
+    }
+    lastNotificationTest[channel] = now
+    mu.Unlock()
+
+    deliveries := []delivery{}
+    record := func(name, target string, err error) {
+        d := delivery{Name: name, Target: target, Success: err == nil}
+        if err != nil {
+            d.Error = err.Error()
+        }
+        deliveries = append(deliveries, d)
+    }
+    if channel == "email" {
+        record("email", cfg.NotifyEmail, sendEmail(cfg, emailDelivery{
+            To:      cfg.NotifyEmail,
+            Subject: "Proctor test notification",
+            Body:    fmt.Sprintf("This is a test notification sent by %s at %s.\n", admin, now.Format(time.RFC1123)),
+        }))
+    }
+    for i, d := range webhooks {
+        d.Payload, _ = json.Marshal(map[string]interface{}{"event": "test", "admin": admin, "time": now})
+        record(webhookNames[i], redactedURL(d.URL), sendWebhook(d))
+    }
+
+    delivered := 0
+    for _, d := range deliveries {
+        if d.Success {
+            delivered++
+        }
+    }
+    mu.Lock()
+    recordAudit(admin, "test-notification", fmt.Sprintf("%s: %d of %d delivered", channel, delivered, len(deliveries)))
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"channel": channel, "deliveries": deliveries})
+}
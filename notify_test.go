@@ -0,0 +1,66 @@
+package main
+
+import (
+    "io/ioutil"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "testing"
+    "time"
+)
+
+func TestTestNotificationSignsLikeDeliveries(t *testing.T) {
+    var signature string
+    var body []byte
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        signature = r.Header.Get("X-Proctor-Signature")
+        body, _ = ioutil.ReadAll(r.Body)
+    }))
+    defer srv.Close()
+
+    old := *testConfig
+    defer func() { *testConfig = old }()
+    testConfig.ViolationWebhookURL = ""
+    testConfig.CompletionWebhookURL = srv.URL
+    testConfig.CompletionWebhookSecret = ""
+    testConfig.WebhookSecret = "shared"
+    mu.Lock()
+    lastNotificationTest = make(map[string]time.Time)
+    mu.Unlock()
+
+    w := serve(withConfig(testConfig, testNotificationHandler), "/test-notification?channel=webhook", url.Values{})
+    if w.Code != 200 {
+        t.Fatalf("testing webhooks: %d %s", w.Code, w.Body.String())
+    }
+    if want := "sha256=" + signPayload("shared", body); signature != want {
+        t.Errorf("signature %q, want %q as real deliveries are signed", signature, want)
+    }
+}
+
+func TestSendMailTimesOut(t *testing.T) {
+    // A server that accepts the connection and never greets.
+    ln, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ln.Close()
+    go func() {
+        if conn, err := ln.Accept(); err == nil {
+            defer conn.Close()
+            time.Sleep(5 * time.Second)
+        }
+    }()
+
+    old := emailTimeout
+    emailTimeout = 100 * time.Millisecond
+    defer func() { emailTimeout = old }()
+
+    start := time.Now()
+    if err := sendMail(ln.Addr().String(), nil, "proctor@example.com", "admin@example.com", []byte("Hi")); err == nil {
+        t.Fatal("sending to a silent server succeeded")
+    }
+    if elapsed := time.Since(start); elapsed > 2*time.Second {
+        t.Errorf("gave up after %s", elapsed)
+    }
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+const passwordHashIterations = 100000
+
+// pbkdf2SHA256 derives a 32-byte key from password and salt (RFC 8018).
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+    mac := hmac.New(sha256.New, password)
+    mac.Write(salt)
+    mac.Write([]byte{0, 0, 0, 1})
+    u := mac.Sum(nil)
+
+    key := make([]byte, len(u))
+    copy(key, u)
+    for i := 1; i < iterations; i++ {
+        mac.Reset()
+        mac.Write(u)
+        u = mac.Sum(u[:0])
+        for j := range key {
+            key[j] ^= u[j]
+        }
+    }
+    return key
+}
+
+// hashPassword returns a salted hash of password in the form
+// pbkdf2-sha256$<iterations>$<salt>$<key>.
+func hashPassword(password string) string {
+    salt := make([]byte, 16)
+    rand.Read(salt)
+    key := pbkdf2SHA256([]byte(password), salt, passwordHashIterations)
+    return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordHashIterations, hex.EncodeToString(salt), hex.EncodeToString(key))
+}
+
+// checkPassword reports whether password matches a hash from hashPassword.
+func checkPassword(hash, password string) bool {
+    parts := strings.Split(hash, "$")
+    if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+        return false
+    }
+    iterations, err := strconv.Atoi(parts[1])
+    if err != nil || iterations <= 0 {
+        return false
+    }
+    salt, err := hex.DecodeString(parts[2])
+    if err != nil {
+        return false
+    }
+    want, err := hex.DecodeString(parts[3])
+    if err != nil {
+        return false
+    }
+
+    got := pbkdf2SHA256([]byte(password), salt, iterations)
+    return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// passwordProblems lists the ways password falls short of
+// Config.PasswordPolicy. An empty result means it is acceptable.
+func passwordProblems(cfg *Config, password string) []string {
+    policy := cfg.PasswordPolicy
+
+    var upper, lower, digit, symbol bool
+    for _, c := range password {
+        switch {
+        case unicode.IsUpper(c):
+            upper = true
+        case unicode.IsLower(c):
+            lower = true
+        case unicode.IsDigit(c):
+            digit = true
+        case !unicode.IsSpace(c):
+            symbol = true
+        }
+    }
+
+    var problems []string
+    if len([]rune(password)) < policy.MinLength {
+        problems = append(problems, fmt.Sprintf("must be at least %d characters", policy.MinLength))
+    }
+    if policy.RequireUpper && !upper {
+        problems = append(problems, "must contain an uppercase letter")
+    }
+    if policy.RequireLower && !lower {
+        problems = append(problems, "must contain a lowercase letter")
+    }
+    if policy.RequireDigit && !digit {
+        problems = append(problems, "must contain a digit")
+    }
+    if policy.RequireSymbol && !symbol {
+        problems = append(problems, "must contain a symbol")
+    }
+    return problems
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// A4 in points, and the margin kept clear on every side
+const (
+    pdfPageWidth  = 595
+    pdfPageHeight = 842
+    pdfMargin     = 56
+)
+
+// pdfDocument lays out wrapped lines of Helvetica text on A4 pages and
+// writes them as a minimal PDF file. It covers what the exam export needs,
+// so no PDF library is required. Characters outside Latin-1 print as "?".
+type pdfDocument struct {
+    pages []*bytes.Buffer // Content stream of each page
+    y     float64         // Baseline of the next line on the last page
+}
+
+// newPage starts a new page and moves to its top.
+func (d *pdfDocument) newPage() {
+    d.pages = append(d.pages, &bytes.Buffer{})
+    d.y = pdfPageHeight - pdfMargin
+}
+
+// space leaves h points of vertical space.
+func (d *pdfDocument) space(h float64) {
+    if len(d.pages) == 0 {
+        d.newPage()
+    }
+    d.y -= h
+}
+
+// text writes s at the given font size, wrapped to the page width less
+// indent. Line breaks in s are kept.
+func (d *pdfDocument) text(s string, size float64, bold bool, indent float64) {
+    font := "F1"
+    charWidth := size * 0.5 // A generous average for Helvetica
+    if bold {
+        font = "F2"
+        charWidth = size * 0.55
+    }
+    perLine := int((pdfPageWidth - 2*pdfMargin - indent) / charWidth)
+
+    for _, paragraph := range strings.Split(s, "\n") {
+        for _, line := range wrapText(paragraph, perLine) {
+            if len(d.pages) == 0 || d.y-size < pdfMargin {
+                d.newPage()
+            }
+            d.y -= size
+            fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %g Tf %g %g Td (%s) Tj ET\n", font, size, pdfMargin+indent, d.y, pdfString(line))
+            d.y -= size * 0.3
+        }
+    }
+}
+
+// WriteTo writes the document as a PDF file.
+func (d *pdfDocument) WriteTo(w io.Writer) (int64, error) {
+    if len(d.pages) == 0 {
+        d.newPage()
+    }
+
+    var out bytes.Buffer
+    var offsets []int
+    object := func(body string) {
+        offsets = append(offsets, out.Len())
+        fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+    }
+
+    // Objects 1-4 are fixed; each page then takes a page and a content object.
+    kids := make([]string, len(d.pages))
+    for i := range d.pages {
+        kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+    }
+    out.WriteString("%PDF-1.4\n")
+    object("<< /Type /Catalog /Pages 2 0 R >>")
+    object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+    object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+    object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+    for i, content := range d.pages {
+        object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i))
+        object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+    }
+
+    xref := out.Len()
+    fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+    for _, offset := range offsets {
+        fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+    }
+    fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+    return out.WriteTo(w)
+}
+
+// wrapText splits s into lines of at most width characters, breaking at
+// spaces where possible. An empty s is one empty line.
+func wrapText(s string, width int) []string {
+    if width < 1 {
+        width = 1
+    }
+    var lines []string
+    line := ""
+    for _, word := range strings.Fields(s) {
+        for len([]rune(word)) > width {
+            if line != "" {
+                lines = append(lines, line)
+                line = ""
+            }
+            runes := []rune(word)
+            lines = append(lines, string(runes[:width]))
+            word = string(runes[width:])
+        }
+        switch {
+        case line == "":
+            line = word
+        case len([]rune(line))+1+len([]rune(word)) <= width:
+            line += " " + word
+        default:
+            lines = append(lines, line)
+            line = word
+        }
+    }
+    return append(lines, line)
+}
+
+// pdfString escapes s for a PDF literal string in WinAnsi encoding.
+func pdfString(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch {
+        case r == '\\' || r == '(' || r == ')':
+            b.WriteByte('\\')
+            b.WriteByte(byte(r))
+        case r == '\t':
+            b.WriteByte(' ')
+        case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > 0xff:
+            b.WriteByte('?')
+        default:
+            b.WriteByte(byte(r))
+        }
+    }
+    return b.String()
+}
+
+// pdfLabel is the label printed before item i of a list: a letter, or a
+// number past Z.
+func pdfLabel(i int) string {
+    if i < 26 {
+        return string(rune('A' + i))
+    }
+    return strconv.Itoa(i + 1)
+}
+
+// answerKeyText describes q's correct answer for a printed answer key.
+func answerKeyText(q Question) string {
+    switch q.Type {
+    case QuestionNumeric:
+        if q.Tolerance > 0 {
+            return fmt.Sprintf("%s (+/- %g)", q.Answer, q.Tolerance)
+        }
+        return q.Answer
+    case QuestionShortAnswer:
+        if q.ManualGrading {
+            return "Graded by hand: " + q.Rubric
+        }
+        return q.Answer
+    case QuestionOrdering:
+        order, _ := parseIndexList(q.Answer)
+        labels := make([]string, len(order))
+        for i, index := range order {
+            labels[i] = pdfLabel(index)
+        }
+        return strings.Join(labels, ", ")
+    case QuestionMatching:
+        pairs, _ := parseIndexList(q.Answer)
+        labels := make([]string, len(pairs))
+        for i, m := range pairs {
+            labels[i] = fmt.Sprintf("%d-%s", i+1, strings.ToLower(pdfLabel(m)))
+        }
+        return strings.Join(labels, ", ")
+    }
+    index, err := strconv.Atoi(q.Answer)
+    if err != nil || index < 0 || index >= len(q.Options) {
+        return q.Answer
+    }
+    return pdfLabel(index) + ". " + q.Options[index]
+}
+
+// API endpoint streaming an exam's questions as a printable PDF, for records
+// or for sitting it on paper. With answers=true an answer key is printed
+// under each question; that needs the view-answers permission too and is
+// audited like viewing the key.
+func exportPDFHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    withAnswers := false
+    if v := r.URL.Query().Get("answers"); v != "" {
+        var err error
+        if withAnswers, err = strconv.ParseBool(v); err != nil {
+            http.Error(w, "Invalid answers value", http.StatusBadRequest)
+            return
+        }
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    exam := findExam(examID)
+    if exam == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    if withAnswers {
+        account, exists := adminAccounts[admin]
+        if !exists || !accountRole(account).Can(PermViewAnswers) {
+            mu.Unlock()
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+        recordAudit(admin, "view-answer-key", fmt.Sprintf("exam %d (pdf)", examID))
+    }
+    title := exam.Title
+    list := examQuestions(exam)
+    sections := make([]*Section, len(list))
+    for i, q := range list {
+        if i == 0 || q.Section != list[i-1].Section {
+            if s := findSection(exam, q.Section); s != nil {
+                section := *s
+                sections[i] = &section
+            }
+        }
+    }
+    mu.Unlock()
+
+    var doc pdfDocument
+    doc.text(title, 18, true, 0)
+    heading := fmt.Sprintf("%d questions", len(list))
+    if withAnswers {
+        heading += " - with answer key"
+    }
+    doc.text(heading, 10, false, 0)
+    doc.space(12)
+
+    for i, q := range list {
+        if section := sections[i]; section != nil {
+            doc.space(6)
+            doc.text(section.Name, 14, true, 0)
+            if section.Instructions != "" {
+                doc.text(section.Instructions, 10, false, 0)
+            }
+            doc.space(6)
+        }
+
+        doc.text(fmt.Sprintf("%d. %s", i+1, q.Text), 11, true, 0)
+        switch q.Type {
+        case QuestionNumeric, QuestionShortAnswer:
+            doc.text("Answer: ______________________________", 11, false, 18)
+        case QuestionMatching:
+            for j, item := range q.Options {
+                doc.text(fmt.Sprintf("%d. %s", j+1, item), 11, false, 18)
+            }
+            for j, match := range q.Matches {
+                doc.text(fmt.Sprintf("%s. %s", strings.ToLower(pdfLabel(j)), match), 11, false, 36)
+            }
+        default:
+            for j, option := range q.Options {
+                doc.text(fmt.Sprintf("%s. %s", pdfLabel(j), option), 11, false, 18)
+            }
+        }
+        if withAnswers {
+            doc.text("Answer: "+answerKeyText(q), 10, true, 18)
+        }
+        doc.space(10)
+    }
+
+    suffix := "blank"
+    if withAnswers {
+        suffix = "key"
+    }
+    w.Header().Set("Content-Type", "application/pdf")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"exam-%d-%s.pdf\"", examID, suffix))
+    doc.WriteTo(w)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "log"
+    "os"
+)
+
+const questionsFile = "questions.json"
+
+// loadQuestions reads the persisted question bank. It must run after the
+// exams, results and question flags are loaded: questionIDCounter is moved
+// past every ID they refer to, so a new question never takes the ID of one
+// they still point at.
+func loadQuestions() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    if err := loadJSON(questionsFile, &questions); err != nil && !os.IsNotExist(err) {
+        log.Fatalf("loading %s: %v", questionsFile, err)
+    }
+
+    for _, q := range questions {
+        questionIDCounter = nextIDAfter(questionIDCounter, q.ID)
+    }
+    for _, e := range exams {
+        for _, id := range e.QuestionIDs {
+            questionIDCounter = nextIDAfter(questionIDCounter, id)
+        }
+    }
+    for _, res := range results {
+        for _, id := range res.QuestionIDs {
+            questionIDCounter = nextIDAfter(questionIDCounter, id)
+        }
+        for id := range res.Answers {
+            questionIDCounter = nextIDAfter(questionIDCounter, id)
+        }
+    }
+    for _, f := range questionFlags {
+        questionIDCounter = nextIDAfter(questionIDCounter, f.QuestionID)
+    }
+}
+
+// saveQuestions writes the question bank to disk, logging any error. Caller
+// must hold mu.
+func saveQuestions() {
+    if err := saveJSON(questionsFile, questions); err != nil {
+        log.Printf("saving %s: %v", questionsFile, err)
+    }
+}
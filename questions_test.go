@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestLoadQuestionsCounter(t *testing.T) {
+    resetState(t, 3)
+    mu.Lock()
+    saveQuestions()
+    exams = []Exam{{ID: 1, QuestionIDs: []int{1, 7}}}
+    results = []Result{{Username: "alice", QuestionIDs: []int{2, 8}, Answers: map[int]string{9: "0"}}}
+    questionFlags = []QuestionFlag{{QuestionID: 12}}
+    questions = nil
+    questionIDCounter = 1
+    mu.Unlock()
+    defer func() { questionFlags = nil }()
+
+    loadQuestions()
+    if len(questions) != 3 || questions[2].ID != 3 {
+        t.Fatalf("loaded %d questions, want 3", len(questions))
+    }
+    // Question 12 is gone from the bank but still flagged.
+    if questionIDCounter != 13 {
+        t.Errorf("questionIDCounter = %d, want 13", questionIDCounter)
+    }
+}
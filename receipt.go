@@ -0,0 +1,97 @@
+package main
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+)
+
+// Receipt is a signed record of a result a student can keep as proof.
+type Receipt struct {
+    Username  string `json:"username"`
+    ExamID    int    `json:"examId"`
+    Exam      string `json:"exam"`
+    Score     int    `json:"score"`
+    Timestamp int64  `json:"timestamp"`
+    Signature string `json:"signature"`
+}
+
+const receiptSecretFile = "receipt_secret.json"
+
+// loadReceiptSecret sets cfg.ReceiptSecret, when it isn't configured, to
+// the secret kept in the data directory, generating and saving one on first
+// run.
+func loadReceiptSecret(cfg *Config) {
+    if cfg.ReceiptSecret != "" {
+        return
+    }
+    err := loadJSON(receiptSecretFile, &cfg.ReceiptSecret)
+    if err != nil && !os.IsNotExist(err) {
+        log.Fatalf("loading %s: %v", receiptSecretFile, err)
+    }
+    if cfg.ReceiptSecret != "" {
+        return
+    }
+    cfg.ReceiptSecret = newSessionToken()
+    if err := saveJSON(receiptSecretFile, cfg.ReceiptSecret); err != nil {
+        log.Fatalf("saving %s: %v", receiptSecretFile, err)
+    }
+}
+
+// receiptSignature returns the HMAC-SHA256 over the receipt's fields.
+func receiptSignature(cfg *Config, rc Receipt) string {
+    mac := hmac.New(sha256.New, []byte(cfg.ReceiptSecret))
+    fmt.Fprintf(mac, "%s\n%d\n%s\n%d\n%d", rc.Username, rc.ExamID, rc.Exam, rc.Score, rc.Timestamp)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newReceipt builds a signed receipt for res. Caller must hold mu.
+func newReceipt(cfg *Config, res Result) Receipt {
+    title := ""
+    if exam := findExam(res.ExamID); exam != nil {
+        title = exam.Title
+    }
+
+    rc := Receipt{
+        Username:  res.Username,
+        ExamID:    res.ExamID,
+        Exam:      title,
+        Score:     res.Score,
+        Timestamp: res.SubmittedAt.Unix(),
+    }
+    rc.Signature = receiptSignature(cfg, rc)
+    return rc
+}
+
+// latestResult returns username's most recent result. Caller must hold mu.
+func latestResult(username string) (Result, bool) {
+    for i := len(results) - 1; i >= 0; i-- {
+        if results[i].Username == username {
+            return results[i], true
+        }
+    }
+    return Result{}, false
+}
+
+// API endpoint checking a receipt's signature
+func verifyReceiptHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    var rc Receipt
+    if err := json.NewDecoder(r.Body).Decode(&rc); err != nil {
+        http.Error(w, "Error parsing receipt", http.StatusBadRequest)
+        return
+    }
+
+    valid := hmac.Equal([]byte(rc.Signature), []byte(receiptSignature(cfg, rc)))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]bool{"valid": valid})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestReceiptSecretSurvivesRestart(t *testing.T) {
+    old := testConfig.ReceiptSecret
+    defer func() { testConfig.ReceiptSecret = old }()
+
+    testConfig.ReceiptSecret = ""
+    loadReceiptSecret(testConfig)
+    first := testConfig.ReceiptSecret
+    if first == "" {
+        t.Fatal("no secret generated")
+    }
+    rc := Receipt{Username: "alice", ExamID: 1, Exam: "Exam", Score: 3, Timestamp: 1}
+    signature := receiptSignature(testConfig, rc)
+
+    // A restart loads the saved secret, so old receipts still verify.
+    testConfig.ReceiptSecret = ""
+    loadReceiptSecret(testConfig)
+    if testConfig.ReceiptSecret != first || receiptSignature(testConfig, rc) != signature {
+        t.Error("the secret changed across a restart")
+    }
+
+    // A configured secret wins over the saved one.
+    testConfig.ReceiptSecret = "configured"
+    loadReceiptSecret(testConfig)
+    if testConfig.ReceiptSecret != "configured" {
+        t.Errorf("configured secret replaced with %q", testConfig.ReceiptSecret)
+    }
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+    "math/rand"
+    "time"
+)
+
+// recheckEnabled reports whether exam asks for identity re-checks.
+func recheckEnabled(exam *Exam) bool {
+    return exam != nil && exam.RecheckMaxMinutes > 0
+}
+
+// scheduleRecheck picks when the session's next identity re-check is due, a
+// random time between the exam's minimum and maximum interval after now. It
+// clears the schedule when the exam has re-checks off. Caller must hold mu.
+func scheduleRecheck(session *ExamSession, now time.Time) {
+    exam := findExam(session.ExamID)
+    if !recheckEnabled(exam) {
+        session.NextRecheck = time.Time{}
+        return
+    }
+    min := time.Duration(exam.RecheckMinMinutes) * time.Minute
+    max := time.Duration(exam.RecheckMaxMinutes) * time.Minute
+    wait := min
+    if max > min {
+        wait += time.Duration(rand.Int63n(int64(max - min)))
+    }
+    session.NextRecheck = now.Add(wait)
+}
+
+// recheckRequired reports whether the student must re-validate their face
+// before continuing, marking the re-check pending once it falls due. Caller
+// must hold mu.
+func recheckRequired(session *ExamSession, now time.Time) bool {
+    if !session.RecheckPending && !session.NextRecheck.IsZero() && !now.Before(session.NextRecheck) {
+        session.RecheckPending = true
+    }
+    return session.RecheckPending
+}
+
+// finishRecheck settles a pending re-check with the result of a face
+// validation. A failure is recorded as a FACE_RECHECK_FAILED violation and
+// the re-check stays pending; it reports whether the exam is now terminated.
+// Caller must hold mu.
+func finishRecheck(cfg *Config, session *ExamSession, matched bool, imagePath string, now time.Time) bool {
+    if matched {
+        session.RecheckPending = false
+        // Serve the question that was interrupted again if it is unanswered.
+        session.Resumed = true
+        scheduleRecheck(session, now)
+        return false
+    }
+    if !violationEnabled(session.Username, "FACE_RECHECK_FAILED") {
+        return false
+    }
+    _, terminated := recordViolation(cfg, session.Username, "FACE_RECHECK_FAILED", "", imagePath)
+    return terminated
+}
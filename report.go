@@ -0,0 +1,223 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "time"
+)
+
+type reportEvent struct {
+    ID       int       `json:"id"`
+    Type     string    `json:"type"`
+    Detail   string    `json:"detail,omitempty"`
+    Weight   int       `json:"weight"`
+    Duration float64   `json:"durationSeconds,omitempty"`
+    Time     time.Time `json:"time"`
+    ImageURL string    `json:"imageUrl,omitempty"`
+}
+
+// API endpoint assembling everything recorded about one student's attempt
+func reportHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+
+    // An omitted exam reports across all of the student's exams.
+    examID := 0
+    if r.URL.Query().Get("exam") != "" {
+        id, ok := examIDParam(r, "exam")
+        if !ok {
+            http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+            return
+        }
+        examID = id
+    }
+
+    mu.Lock()
+    userResults := []Result{}
+    for _, res := range results {
+        if res.Username == username && (examID == 0 || res.ExamID == examID) {
+            userResults = append(userResults, res)
+        }
+    }
+
+    events := []reportEvent{}
+    total := 0
+    for _, e := range violationEvents {
+        if e.Username != username || (examID != 0 && e.ExamID != examID) || e.Simulated {
+            continue
+        }
+        event := reportEvent{
+            ID:       e.ID,
+            Type:     e.Type,
+            Detail:   e.Detail,
+            Weight:   e.Weight,
+            Time:     e.Time,
+            Duration: e.Duration.Seconds(),
+        }
+        if e.ImagePath != "" {
+            event.ImageURL = captureURL(e.ImagePath)
+        }
+        events = append(events, event)
+        total += e.Weight
+    }
+
+    // Submitted attempts carry these on their result instead.
+    var liveTimings []AnswerTiming
+    var liveDisconnections []Disconnection
+    var liveChanges map[string]int
+    if session, ok := examSessions[username]; ok && (examID == 0 || session.ExamID == examID) {
+        liveTimings = answerTimings(cfg, session)
+        liveDisconnections = append(liveDisconnections, session.Disconnections...)
+        liveChanges = answerChangeCounts(session)
+    }
+    mu.Unlock()
+
+    snapshots := []string{}
+    if validPathName(username) {
+        dir := filepath.Join("captured_images", username)
+        if files, err := ioutil.ReadDir(dir); err == nil {
+            for _, file := range files {
+                if !file.IsDir() {
+                    snapshots = append(snapshots, captureURL(filepath.Join(dir, file.Name())))
+                }
+            }
+        }
+    }
+    sort.Strings(snapshots)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "username":       username,
+        "examId":         examID,
+        "results":        userResults,
+        "violationCount": total,
+        "violations":     events,
+        "snapshots":      snapshots,
+        "answerTimings":  liveTimings,
+        "disconnections": liveDisconnections,
+        "answerChanges":  liveChanges,
+        "generatedAt":    time.Now(),
+    })
+}
+
+// timelineBucket counts the violations in one interval of an attempt.
+type timelineBucket struct {
+    Offset int            `json:"offsetSeconds"` // Start of the bucket, from the origin
+    Start  time.Time      `json:"start"`
+    Count  int            `json:"count"`
+    Weight int            `json:"weight"`
+    Types  map[string]int `json:"types,omitempty"`
+}
+
+// maxTimelineBuckets bounds how finely /api/violation-timeline slices an
+// attempt.
+const maxTimelineBuckets = 1000
+
+// API endpoint bucketing a student's violations in an exam by ?interval=
+// seconds (default 60) for charting. The origin is when the attempt started:
+// the live session's start, or the latest result's. Violations raised
+// before it, e.g. while reading the instructions, fall in the first bucket.
+// Simulated violations are left out.
+func violationTimelineHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    username := r.URL.Query().Get("user")
+    examID, ok := examIDParam(r, "exam")
+    if username == "" || !ok {
+        http.Error(w, "User and exam are required", http.StatusBadRequest)
+        return
+    }
+    interval := 60
+    if v := r.URL.Query().Get("interval"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            http.Error(w, "Invalid interval", http.StatusBadRequest)
+            return
+        }
+        interval = n
+    }
+
+    now := time.Now()
+    mu.Lock()
+    var origin, end time.Time
+    if session, ok := examSessions[username]; ok && session.ExamID == examID {
+        origin, end = session.AcknowledgedAt, now
+        if origin.IsZero() {
+            origin = session.StartedAt
+        }
+    } else {
+        for i := len(results) - 1; i >= 0; i-- {
+            if results[i].Username == username && results[i].ExamID == examID {
+                origin, end = results[i].StartedAt, results[i].SubmittedAt
+                break
+            }
+        }
+    }
+    var events []ViolationEvent
+    for _, e := range violationEvents {
+        if e.Username == username && e.ExamID == examID && !e.Simulated {
+            events = append(events, e)
+        }
+    }
+    mu.Unlock()
+
+    // Results from before start times were kept begin at the first event.
+    if origin.IsZero() && len(events) > 0 {
+        origin = events[0].Time
+    }
+    if origin.IsZero() {
+        http.Error(w, "No attempt found", http.StatusNotFound)
+        return
+    }
+    if len(events) > 0 && events[len(events)-1].Time.After(end) {
+        end = events[len(events)-1].Time
+    }
+    if end.Before(origin) {
+        end = origin
+    }
+
+    step := time.Duration(interval) * time.Second
+    count := int(end.Sub(origin)/step) + 1
+    if count > maxTimelineBuckets {
+        http.Error(w, fmt.Sprintf("Interval too small; the attempt would need more than %d buckets", maxTimelineBuckets), http.StatusBadRequest)
+        return
+    }
+    buckets := make([]timelineBucket, count)
+    for i := range buckets {
+        buckets[i].Offset = i * interval
+        buckets[i].Start = origin.Add(time.Duration(i) * step)
+    }
+    for _, e := range events {
+        i := 0
+        if e.Time.After(origin) {
+            i = int(e.Time.Sub(origin) / step)
+        }
+        b := &buckets[i]
+        b.Count++
+        b.Weight += e.Weight
+        if b.Types == nil {
+            b.Types = make(map[string]int)
+        }
+        b.Types[e.Type]++
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "username":        username,
+        "examId":          examID,
+        "origin":          origin,
+        "end":             end,
+        "intervalSeconds": interval,
+        "buckets":         buckets,
+    })
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+    "log"
+    "os"
+    "time"
+)
+
+const resultsFile = "results.json"
+
+// loadResults reads the persisted results.
+func loadResults() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    if err := loadJSON(resultsFile, &results); err != nil && !os.IsNotExist(err) {
+        log.Fatalf("loading %s: %v", resultsFile, err)
+    }
+}
+
+// saveResults writes every result to disk. Caller must hold mu.
+func saveResults() error {
+    return saveJSON(resultsFile, results)
+}
+
+// runAnswerCleanup periodically drops the stored answers of old results.
+// It does nothing unless Config.AnswerRetentionDays is set.
+func runAnswerCleanup(cfg *Config) {
+    if cfg.AnswerRetentionDays <= 0 {
+        return
+    }
+
+    ticker := time.NewTicker(time.Duration(cfg.CleanupIntervalMinutes) * time.Minute)
+    defer ticker.Stop()
+
+    for {
+        purged := purgeOldAnswers(time.Now().AddDate(0, 0, -cfg.AnswerRetentionDays))
+        log.Printf("answer cleanup: dropped the answers of %d results", purged)
+        <-ticker.C
+    }
+}
+
+// purgeOldAnswers removes the answers and served questions from results
+// submitted before cutoff and returns how many were changed. Scores are
+// kept, but those results can no longer be regraded or reviewed. Results
+// still waiting on manual grading keep their answers.
+func purgeOldAnswers(cutoff time.Time) int {
+    mu.Lock()
+    defer mu.Unlock()
+
+    purged := 0
+    for i := range results {
+        res := &results[i]
+        if res.Answers == nil || res.GradingPending || !res.SubmittedAt.Before(cutoff) {
+            continue
+        }
+        res.Answers = nil
+        res.QuestionIDs = nil
+        purged++
+    }
+    if purged > 0 {
+        if err := saveResults(); err != nil {
+            log.Printf("saving %s: %v", resultsFile, err)
+        }
+    }
+    return purged
+}
@@ -0,0 +1,78 @@
+package main
+
+import "net/http"
+
+// Role determines what a signed-in staff account may do.
+type Role string
+
+const (
+    RoleAdmin   Role = "admin"   // Full access
+    RoleProctor Role = "proctor" // Monitors exams but cannot edit them
+    RoleGrader  Role = "grader"  // Sees results only
+)
+
+// Permission names a group of endpoints.
+type Permission string
+
+const (
+    PermManageExams  Permission = "manage_exams"  // Questions, exams and their settings
+    PermManageUsers  Permission = "manage_users"  // Students and staff accounts
+    PermMonitor      Permission = "monitor"       // Live sessions, violations and evidence
+    PermViewResults  Permission = "view_results"  // Scores and answers
+    PermViewAnswers  Permission = "view_answers"  // The correct answers to every question
+    PermAdjustScores Permission = "adjust_scores" // Manual changes to recorded scores
+    PermManageSystem Permission = "manage_system" // Backups, audit log and configuration
+)
+
+var rolePermissions = map[Role][]Permission{
+    RoleAdmin:   {PermManageExams, PermManageUsers, PermMonitor, PermViewResults, PermViewAnswers, PermAdjustScores, PermManageSystem},
+    RoleProctor: {PermMonitor, PermViewResults},
+    RoleGrader:  {PermViewResults, PermViewAnswers, PermAdjustScores},
+}
+
+// validRole reports whether role is one of the defined roles.
+func validRole(role Role) bool {
+    _, ok := rolePermissions[role]
+    return ok
+}
+
+// Can reports whether the role grants p.
+func (role Role) Can(p Permission) bool {
+    for _, granted := range rolePermissions[role] {
+        if granted == p {
+            return true
+        }
+    }
+    return false
+}
+
+// accountRole returns the role of an admin account. Accounts created before
+// roles existed are admins. Caller must hold mu.
+func accountRole(account AdminAccount) Role {
+    if account.Role == "" {
+        return RoleAdmin
+    }
+    return account.Role
+}
+
+// requirePermission only lets through signed-in accounts whose role grants p.
+func requirePermission(p Permission, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        username, ok := adminFromRequest(r)
+        if !ok {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        mu.Lock()
+        account, exists := adminAccounts[username]
+        allowed := exists && accountRole(account).Can(p)
+        mu.Unlock()
+
+        if !allowed {
+            http.Error(w, "Forbidden", http.StatusForbidden)
+            return
+        }
+        next(w, r)
+    }
+}
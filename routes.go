@@ -0,0 +1,175 @@
+package main
+
+import "net/http"
+
+// middleware wraps a handler with a check shared by a group of routes.
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// routeGroup registers routes on a mux, each wrapped in the group's
+// middleware. The first middleware listed runs first.
+type routeGroup struct {
+    mux        *http.ServeMux
+    middleware []middleware
+}
+
+// with returns a group that runs mw after g's own middleware.
+func (g routeGroup) with(mw ...middleware) routeGroup {
+    chain := append(append([]middleware(nil), g.middleware...), mw...)
+    return routeGroup{mux: g.mux, middleware: chain}
+}
+
+// permission returns a group restricted to admins holding p.
+func (g routeGroup) permission(p Permission) routeGroup {
+    return g.with(func(next http.HandlerFunc) http.HandlerFunc {
+        return requirePermission(p, next)
+    })
+}
+
+// withConfig adapts a handler that reads the configuration to an
+// http.HandlerFunc serving with cfg.
+func withConfig(cfg *Config, h func(*Config, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        h(cfg, w, r)
+    }
+}
+
+// handle registers h for pattern behind the group's middleware.
+func (g routeGroup) handle(pattern string, h http.HandlerFunc) {
+    for i := len(g.middleware) - 1; i >= 0; i-- {
+        h = g.middleware[i](h)
+    }
+    g.mux.HandleFunc(pattern, h)
+}
+
+// newRouter returns the mux serving every route, grouped by who may call
+// them:
+//   - public: login and static pages, and lookups anyone may make
+//   - internal: health and version probes for operators' tooling
+//   - student: the exam itself, only from the allowed exam networks
+//   - admin: management pages and APIs, by permission
+func newRouter(cfg *Config) *http.ServeMux {
+    mux := http.NewServeMux()
+    root := routeGroup{mux: mux}
+
+    public := root
+    public.handle("/", loginPage)
+    public.handle("/login", withConfig(cfg, loginHandler))
+    public.handle("/score", withConfig(cfg, scorePage))
+    public.handle("/admin-login", ServeadminloginPage)
+    public.handle("/selection", ServeselectionPage)
+    public.handle("/add-question-page", Serveaddquestion) // Serves the management page
+    public.handle("/reference-images/", serveReferenceImage)
+    public.handle("/question-audio/", serveQuestionAudio)
+    // Used by the login and add student pages as well as during the exam
+    public.handle("/validate-face", withConfig(cfg, validateFaceHandler))
+    public.handle("/verify-receipt", withConfig(cfg, verifyReceiptHandler))
+    public.handle("/api/exam-config", withConfig(cfg, examConfigHandler))
+    public.handle("/api/notice", withConfig(cfg, noticeHandler))
+    public.handle("/api/exams", withConfig(cfg, getExamsHandler))
+    public.handle("/api/leaderboard", leaderboardHandler)
+    public.handle("/api/", apiNotFoundHandler)
+
+    internal := root
+    internal.handle("/healthz", healthzHandler)
+    internal.handle("/version", versionHandler)
+
+    student := root.with(requireExamNetwork(cfg))
+    student.handle("/exam", examPage)
+    student.handle("/proctor", withConfig(cfg, proctorPage))
+    student.handle("/capture", withConfig(cfg, captureHandler))
+    student.handle("/submit", withConfig(cfg, submitHandler))
+    student.handle("/start-exam", withConfig(cfg, startExamHandler))
+    student.handle("/heartbeat", withConfig(cfg, heartbeatHandler))
+    student.handle("/get-next-question", withConfig(cfg, getNextQuestionHandler))
+    student.handle("/get-questions", withConfig(cfg, batchQuestionsHandler))
+    student.handle("/submit-section", withConfig(cfg, submitSectionHandler))
+    student.handle("/save-answer", withConfig(cfg, saveAnswerHandler))
+    student.handle("/api/review-before-submit", reviewBeforeSubmitHandler)
+    student.handle("/flag-question", flagQuestionHandler)
+    student.handle("/api/violations-remaining", withConfig(cfg, violationsRemainingHandler))
+    student.handle("/api/remaining", remainingTimeHandler)
+    student.handle("/fullscreen-violation", withConfig(cfg, fullscreenViolationHandler))
+    student.handle("/tab-change-violation", withConfig(cfg, tabChangeViolationHandler))
+    student.handle("/window-change-violation", withConfig(cfg, windowChangeViolationHandler))
+
+    admin := root.with(requireAdmin)
+    admin.handle("/api/confirm-token", confirmTokenHandler)
+
+    manageExams := admin.permission(PermManageExams)
+    manageExams.handle("/add-question", withConfig(cfg, addQuestionHandler))
+    manageExams.handle("/api/questions", getQuestionsHandler) // API to get all questions
+    manageExams.handle("/import-questions", withConfig(cfg, importQuestionsHandler))
+    manageExams.handle("/api/question-usage", questionUsageHandler)
+    manageExams.handle("/api/questions/invalid", withConfig(cfg, invalidQuestionsHandler))
+    manageExams.handle("/api/question-preview", questionPreviewHandler)
+    manageExams.handle("/question-translation", questionTranslationHandler)
+    manageExams.handle("/delete-question", deleteQuestionHandler) // API to delete a question
+    manageExams.handle("/api/question-flags", questionFlagsHandler)
+    manageExams.handle("/api/exam-summary", examSummaryHandler)
+    manageExams.handle("/api/validate-exam", withConfig(cfg, validateExamHandler))
+    manageExams.handle("/exam-sections", updateExamSectionsHandler)
+    manageExams.handle("/exam-settings", withConfig(cfg, examSettingsHandler))
+    manageExams.handle("/exam-access-code", examAccessCodeHandler)
+    manageExams.handle("/assign-questions", assignQuestionsHandler)
+    manageExams.handle("/clone-exam", cloneExamHandler)
+    manageExams.handle("/reorder-exams", reorderExamsHandler)
+    manageExams.handle("/exam-violation-types", withConfig(cfg, examViolationTypesHandler))
+    manageExams.handle("/export-blank", exportBlankHandler)
+    manageExams.handle("/export-pdf", exportPDFHandler)
+    // These undo terminations and evidence, so they are not for monitors.
+    manageExams.handle("/reset-violations-bulk", withConfig(cfg, resetViolationsBulkHandler))
+    manageExams.handle("/regenerate-attempt", regenerateAttemptHandler)
+
+    manageUsers := admin.permission(PermManageUsers)
+    manageUsers.handle("/add-student", withConfig(cfg, addStudentHandler))
+    manageUsers.handle("/delete-student", deleteStudentHandler)
+    manageUsers.handle("/api/students/unenrolled", withConfig(cfg, unenrolledStudentsHandler))
+    manageUsers.handle("/import-faces", withConfig(cfg, importFacesHandler))
+    manageUsers.handle("/api/duplicate-students", withConfig(cfg, duplicateStudentsHandler))
+    manageUsers.handle("/merge-students", mergeStudentsHandler)
+    manageUsers.handle("/api/admins", listAdminsHandler)
+    manageUsers.handle("/add-admin", withConfig(cfg, addAdminHandler))
+    manageUsers.handle("/set-admin-role", setAdminRoleHandler)
+    manageUsers.handle("/delete-admin", deleteAdminHandler)
+
+    monitor := admin.permission(PermMonitor)
+    monitor.handle("/export-violations", exportViolationsHandler)
+    monitor.handle("/api/captures", searchCapturesHandler)
+    monitor.handle("/api/download-captures", downloadCapturesHandler)
+    monitor.handle("/api/violation-image", violationImageHandler)
+    monitor.handle("/api/report", withConfig(cfg, reportHandler))
+    monitor.handle("/api/violation-timeline", violationTimelineHandler)
+    monitor.handle("/api/session-ips", sessionIPsHandler)
+    monitor.handle("/api/active-sessions", withConfig(cfg, activeSessionsHandler))
+    monitor.handle("/api/completion-count", completionCountHandler)
+    monitor.handle("/api/progress", withConfig(cfg, progressHandler))
+    monitor.handle("/api/answer-timings", withConfig(cfg, answerTimingsHandler))
+    monitor.handle("/api/view-attempt", viewAttemptHandler)
+    monitor.handle("/captured-images/", serveCapturedImage)
+
+    viewResults := admin.permission(PermViewResults)
+    viewResults.handle("/admin", withConfig(cfg, adminPage))
+    viewResults.handle("/api/similarity", withConfig(cfg, similarityHandler))
+
+    viewAnswers := admin.permission(PermViewAnswers)
+    viewAnswers.handle("/api/answer-key", answerKeyHandler)
+    viewAnswers.handle("/api/answer-distribution", withConfig(cfg, answerDistributionHandler))
+
+    adjustScores := admin.permission(PermAdjustScores)
+    adjustScores.handle("/recompute-results", withConfig(cfg, recomputeResultsHandler))
+    adjustScores.handle("/grade-response", gradeResponseHandler)
+    adjustScores.handle("/adjust-score", adjustScoreHandler)
+    adjustScores.handle("/reassign-result", withConfig(cfg, reassignResultHandler))
+
+    manageSystem := admin.permission(PermManageSystem)
+    manageSystem.handle("/api/simulate-violation", withConfig(cfg, simulateViolationHandler))
+    manageSystem.handle("/purge-simulated-violations", withConfig(cfg, purgeSimulatedViolationsHandler))
+    manageSystem.handle("/api/audit-log", auditLogHandler)
+    manageSystem.handle("/api/metrics", metricsHandler)
+    manageSystem.handle("/api/config", withConfig(cfg, configHandler))
+    manageSystem.handle("/api/test-notification", withConfig(cfg, testNotificationHandler))
+    manageSystem.handle("/api/backup", withConfig(cfg, backupHandler))
+    manageSystem.handle("/api/restore", restoreHandler)
+
+    return mux
+}
@@ -0,0 +1,885 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ExamSession tracks a student's exam from the proctor page until submission.
+type ExamSession struct {
+    Username     string
+    ExamID       int
+    StartedAt    time.Time
+    LastCapture  time.Time
+    LastActivity time.Time // Last capture or question fetch
+    LastSeen     time.Time // Last heartbeat from the proctor page
+    Terminated   bool      // Set once the student reaches the violation limit
+    // QuestionIDs lists the attempt's questions in served order. It is fixed
+    // when the session opens so that questions deleted or reordered in the
+    // bank later don't shift an attempt in progress.
+    QuestionIDs []int
+    // Answers holds the student's answers so far, keyed by position in
+    // QuestionIDs.
+    Answers map[string]string
+    // ServedAt and AnsweredAt hold when each question was served and last
+    // answered, keyed like Answers.
+    ServedAt   map[string]time.Time
+    AnsweredAt map[string]time.Time
+    // AnswerHistory lists every value each answer has held, keyed like
+    // Answers, for exams with TrackAnswerChanges.
+    AnswerHistory map[string][]AnswerChange
+    // Resumed is set when the proctor page is reopened mid-exam.
+    Resumed bool
+    // AcknowledgedAt is when the student read the instructions and started;
+    // no questions are served before it.
+    AcknowledgedAt time.Time
+    // Disconnections lists the gaps in the student's heartbeats.
+    Disconnections []Disconnection
+    // BankDeadline is when a time bank exam runs out; zero in per-question mode.
+    BankDeadline time.Time
+    // NextRecheck is when the next identity re-check falls due; zero when the
+    // exam has none. RecheckPending blocks questions until the face matches.
+    NextRecheck    time.Time
+    RecheckPending bool
+    // SubmittedInGrace is set when the final submission arrived after the
+    // deadline but within submitGrace.
+    SubmittedInGrace bool
+    // SubmittedSections maps each section submitted on its own to the score
+    // it was given. Answers in these sections can no longer change.
+    SubmittedSections map[string]int
+    // AnswerDeadlines holds when each question served in a batch stops
+    // accepting answers, keyed like Answers. Batches are timed as if their
+    // questions were answered one after another.
+    AnswerDeadlines map[string]time.Time
+}
+
+// maxQuestionBatch is the most questions /get-questions serves at once.
+const maxQuestionBatch = 50
+
+// bankGrace is how long after the time bank runs out a final submission or
+// answer is still accepted, to allow for network latency.
+const bankGrace = 5 * time.Second
+
+// AnswerChange is one value an answer held during an attempt.
+type AnswerChange struct {
+    Answer string
+    Time   time.Time
+}
+
+// Active exam sessions keyed by username
+var examSessions = make(map[string]*ExamSession)
+
+// startExamSession opens a fresh session for username. Caller must hold mu.
+func startExamSession(username string, examID int) *ExamSession {
+    now := time.Now()
+    session := &ExamSession{
+        Username:     username,
+        ExamID:       examID,
+        StartedAt:    now,
+        LastCapture:  now,
+        LastActivity: now,
+        LastSeen:     now,
+        QuestionIDs:  questionIDs(examQuestions(findExam(examID))),
+        Answers:      make(map[string]string),
+        ServedAt:     make(map[string]time.Time),
+        AnsweredAt:   make(map[string]time.Time),
+    }
+    examSessions[username] = session
+    return session
+}
+
+// sectionLocked reports whether the question at position index of the
+// session's attempt belongs to a section that was already submitted. Caller
+// must hold mu.
+func sectionLocked(session *ExamSession, index int) bool {
+    if len(session.SubmittedSections) == 0 {
+        return false
+    }
+    q, ok := servedQuestion(session, index)
+    if !ok {
+        return false
+    }
+    _, submitted := session.SubmittedSections[q.Section]
+    return submitted
+}
+
+// questionIDs returns the IDs of qs in order.
+func questionIDs(qs []Question) []int {
+    ids := make([]int, len(qs))
+    for i, q := range qs {
+        ids[i] = q.ID
+    }
+    return ids
+}
+
+// servedQuestion returns the question at position index of the session's
+// attempt. It reports false when index is out of range or the question has
+// since been deleted from the bank. Caller must hold mu.
+func servedQuestion(session *ExamSession, index int) (Question, bool) {
+    if index < 0 || index >= len(session.QuestionIDs) {
+        return Question{}, false
+    }
+    q := findQuestion(session.QuestionIDs[index])
+    if q == nil {
+        return Question{}, false
+    }
+    return *q, true
+}
+
+// acknowledgeStart marks the point the student chose to begin, starting a
+// time bank exam's budget. Caller must hold mu.
+func acknowledgeStart(session *ExamSession, now time.Time) {
+    session.AcknowledgedAt = now
+    if exam := findExam(session.ExamID); exam != nil && exam.TimingMode == TimingTimeBank {
+        bank := 0
+        for _, id := range session.QuestionIDs {
+            if q := findQuestion(id); q != nil {
+                bank += q.Time
+            }
+        }
+        session.BankDeadline = now.Add(time.Duration(bank) * time.Second)
+    }
+    scheduleRecheck(session, now)
+}
+
+// recordAnswerChange adds answer to the history of the answer at index when
+// the session's exam tracks changes and the value differs from the last one.
+// Caller must hold mu.
+func recordAnswerChange(session *ExamSession, index, answer string, now time.Time) {
+    exam := findExam(session.ExamID)
+    if exam == nil || !exam.TrackAnswerChanges {
+        return
+    }
+    history := session.AnswerHistory[index]
+    if len(history) > 0 && history[len(history)-1].Answer == answer {
+        return
+    }
+    if session.AnswerHistory == nil {
+        session.AnswerHistory = make(map[string][]AnswerChange)
+    }
+    session.AnswerHistory[index] = append(history, AnswerChange{Answer: answer, Time: now})
+}
+
+// answerChangeCounts returns how many times each tracked answer was changed
+// after it was first given, or nil when nothing was tracked.
+func answerChangeCounts(session *ExamSession) map[string]int {
+    if len(session.AnswerHistory) == 0 {
+        return nil
+    }
+    counts := make(map[string]int, len(session.AnswerHistory))
+    for index, history := range session.AnswerHistory {
+        counts[index] = len(history) - 1
+    }
+    return counts
+}
+
+// bankRemaining returns how much of the session's time bank is left at now.
+// It is only meaningful for time bank exams.
+func bankRemaining(session *ExamSession, now time.Time) time.Duration {
+    return session.BankDeadline.Sub(now)
+}
+
+// bankExpired reports whether the session's time bank ran out more than
+// bankGrace before now.
+func bankExpired(session *ExamSession, now time.Time) bool {
+    return !session.BankDeadline.IsZero() && bankRemaining(session, now) < -bankGrace
+}
+
+// questionDeadline returns when the question served at index runs out of
+// time: the deadline the server enforces for it, or else its time from when
+// it was first served. It reports false for untimed or unserved questions.
+// Caller must hold mu.
+func questionDeadline(session *ExamSession, index int) (time.Time, bool) {
+    key := strconv.Itoa(index)
+    if deadline, ok := session.AnswerDeadlines[key]; ok {
+        return deadline, true
+    }
+    servedAt, served := session.ServedAt[key]
+    q, ok := servedQuestion(session, index)
+    if !served || !ok || q.Time <= 0 {
+        return time.Time{}, false
+    }
+    return servedAt.Add(time.Duration(q.Time) * time.Second), true
+}
+
+// API endpoint giving the exam page the authoritative time left, so its local
+// countdown can be corrected for drift. A time bank attempt reports the bank,
+// answering 410 Gone once it has run out so the page submits; otherwise the
+// question on screen is reported, if it is timed. An expired question reports
+// 0 seconds so the page moves on, unless it is the last one: then the exam's
+// time is up too and the answer is 410 Gone.
+func remainingTimeHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    now := time.Now()
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok || session.Terminated || session.ExamID != examID {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+
+    resp := map[string]interface{}{
+        "serverTime": now,
+        "started":    !session.AcknowledgedAt.IsZero(),
+        "mode":       "untimed",
+    }
+    if !session.BankDeadline.IsZero() {
+        // Matches get-next-question, which ends the exam at zero whole seconds.
+        left := int(bankRemaining(session, now).Seconds())
+        if left <= 0 {
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(http.StatusGone)
+            json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Time is up", "serverTime": now})
+            return
+        }
+        resp["mode"] = "time_bank"
+        resp["deadline"] = session.BankDeadline
+        resp["remainingSeconds"] = left
+    } else if index := userQuestionIndex[username] - 1; index >= 0 {
+        if deadline, ok := questionDeadline(session, index); ok {
+            left := int(deadline.Sub(now).Seconds())
+            if left <= 0 && index == len(session.QuestionIDs)-1 {
+                w.Header().Set("Content-Type", "application/json")
+                w.WriteHeader(http.StatusGone)
+                json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Time is up", "serverTime": now})
+                return
+            }
+            if left < 0 {
+                left = 0
+            }
+            resp["mode"] = "question"
+            resp["questionIndex"] = index
+            resp["deadline"] = deadline
+            resp["remainingSeconds"] = left
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// submitGrace is how long after the deadline a final submission still
+// counts: bankGrace plus the configured allowance for slow networks.
+func submitGrace(cfg *Config) time.Duration {
+    return bankGrace + time.Duration(cfg.SubmitGraceSeconds)*time.Second
+}
+
+// submissionTiming reports whether a final submission at now comes after
+// the session's deadline and its grace, and whether it comes after the
+// deadline but within the grace.
+func submissionTiming(cfg *Config, session *ExamSession, now time.Time) (late, inGrace bool) {
+    if session.BankDeadline.IsZero() {
+        return false, false
+    }
+    over := -bankRemaining(session, now)
+    if over <= 0 {
+        return false, false
+    }
+    if over > submitGrace(cfg) {
+        return true, false
+    }
+    return false, true
+}
+
+// submitAllowedAt returns the earliest time the session may be submitted,
+// or the zero time when there is no minimum. Caller must hold mu.
+func submitAllowedAt(session *ExamSession) time.Time {
+    exam := findExam(session.ExamID)
+    if exam == nil || exam.MinDurationMinutes <= 0 || session.AcknowledgedAt.IsZero() {
+        return time.Time{}
+    }
+    return session.AcknowledgedAt.Add(time.Duration(exam.MinDurationMinutes) * time.Minute)
+}
+
+// answerTimeUp reports whether the question at key was served in a batch and
+// its time, with bankGrace for latency, has run out.
+func answerTimeUp(session *ExamSession, key string, now time.Time) bool {
+    deadline, ok := session.AnswerDeadlines[key]
+    return ok && now.After(deadline.Add(bankGrace))
+}
+
+// autoAdvance reports whether the server enforces each question's timer in
+// session's attempt of exam. Time bank attempts are timed as a whole instead.
+func autoAdvance(session *ExamSession, exam *Exam) bool {
+    return exam != nil && exam.AutoAdvance && session.BankDeadline.IsZero()
+}
+
+// expireQuestions records a blank answer for every question of an auto
+// advancing attempt whose time ran out unanswered, so it is graded as wrong
+// and not served again after a reconnect. It returns the positions expired.
+// Caller must hold mu.
+func expireQuestions(session *ExamSession, exam *Exam, now time.Time) []int {
+    if !autoAdvance(session, exam) {
+        return nil
+    }
+    var expired []int
+    for key := range session.AnswerDeadlines {
+        if _, answered := session.Answers[key]; answered || !answerTimeUp(session, key, now) {
+            continue
+        }
+        session.Answers[key] = ""
+        if index, err := strconv.Atoi(key); err == nil {
+            expired = append(expired, index)
+        }
+    }
+    sort.Ints(expired)
+    return expired
+}
+
+// checkMonitoringGap records a MONITORING_GAP violation when no capture has
+// arrived within the exam's maxCaptureGap. It reports whether a violation was
+// recorded and whether the exam is now terminated. Caller must hold mu.
+func checkMonitoringGap(cfg *Config, session *ExamSession) (bool, bool) {
+    maxGap := maxCaptureGap(cfg, findExam(session.ExamID))
+    if maxGap <= 0 || !violationEnabled(session.Username, "MONITORING_GAP") {
+        return false, false
+    }
+
+    gap := time.Since(session.LastCapture)
+    if gap <= maxGap {
+        return false, false
+    }
+
+    // Restart the window so one gap is only counted once.
+    session.LastCapture = time.Now()
+    _, terminated := recordViolation(cfg, session.Username, "MONITORING_GAP", fmt.Sprintf("%ds", int(gap.Seconds())), "")
+    return true, terminated
+}
+
+// idleTimeout returns how long a session in the given exam may go without
+// activity before it is abandoned. Zero disables the check. Caller must hold mu.
+func idleTimeout(cfg *Config, examID int) time.Duration {
+    minutes := cfg.IdleTimeoutMinutes
+    if exam := findExam(examID); exam != nil && exam.IdleTimeoutMinutes > 0 {
+        minutes = exam.IdleTimeoutMinutes
+    }
+    return time.Duration(minutes) * time.Minute
+}
+
+// runSessionSweeper periodically ends sessions that have gone idle.
+func runSessionSweeper(cfg *Config) {
+    ticker := time.NewTicker(time.Duration(cfg.SweepIntervalSeconds) * time.Second)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        mu.Lock()
+        sweepExpiredBanks(cfg, time.Now())
+        sweepOldSessions(cfg, time.Now())
+        sweepIdleSessions(cfg, time.Now())
+        mu.Unlock()
+    }
+}
+
+// sweepExpiredBanks submits the saved answers of every session whose time
+// bank has run out and whose submission grace has passed. Caller must hold mu.
+func sweepExpiredBanks(cfg *Config, now time.Time) {
+    for username, session := range examSessions {
+        if late, _ := submissionTiming(cfg, session, now); !late {
+            continue
+        }
+        finishAttempt(cfg, username, session.Answers, EndTimeExpired, "")
+        log.Printf("session sweeper: %s ran out of time bank in exam %d", username, session.ExamID)
+    }
+}
+
+// sweepOldSessions ends every session older than
+// Config.MaxSessionLifetimeMinutes, submitting its saved answers. Caller
+// must hold mu.
+func sweepOldSessions(cfg *Config, now time.Time) {
+    lifetime := time.Duration(cfg.MaxSessionLifetimeMinutes) * time.Minute
+    if lifetime <= 0 {
+        return
+    }
+    for username, session := range examSessions {
+        if now.Sub(session.StartedAt) < lifetime {
+            continue
+        }
+        finishAttempt(cfg, username, session.Answers, EndLifetime, "")
+        log.Printf("session sweeper: force-ended %s in exam %d: session exceeded the %s lifetime", username, session.ExamID, lifetime)
+    }
+}
+
+// sweepIdleSessions records every idle session as abandoned, grading the
+// answers it saved. Caller must hold mu.
+func sweepIdleSessions(cfg *Config, now time.Time) {
+    for username, session := range examSessions {
+        timeout := idleTimeout(cfg, session.ExamID)
+        if timeout <= 0 || now.Sub(session.LastActivity) < timeout {
+            continue
+        }
+        finishAttempt(cfg, username, session.Answers, EndAbandoned, "")
+        log.Printf("session sweeper: %s abandoned exam %d after %s idle", username, session.ExamID, timeout)
+    }
+}
+
+// API endpoint letting an admin see a student's attempt as it currently
+// stands, without affecting it
+func viewAttemptHandler(w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    recordAudit(admin, "view-attempt", username)
+
+    // userQuestionIndex points past the question most recently served.
+    var current *StudentQuestion
+    if q, ok := servedQuestion(session, userQuestionIndex[username]-1); ok {
+        served := newStudentQuestion(q, studentLanguage(username), 0)
+        current = &served
+    }
+
+    answers := make(map[string]string, len(session.Answers))
+    for k, v := range session.Answers {
+        answers[k] = v
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "username":        username,
+        "examId":          session.ExamID,
+        "startedAt":       session.StartedAt,
+        "acknowledgedAt":  session.AcknowledgedAt,
+        "questionIndex":   userQuestionIndex[username],
+        "currentQuestion": current,
+        "answers":         answers,
+    })
+}
+
+// API endpoint grading and locking one section of an exam taken section by
+// section. Its saved answers are scored and can't be changed afterwards; once
+// every question is in a submitted section the attempt is finished.
+func submitSectionHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+    section := r.FormValue("section")
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok || session.Terminated {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    exam := findExam(session.ExamID)
+    if exam == nil || !exam.SectionSubmission {
+        http.Error(w, "This exam is not submitted by section", http.StatusBadRequest)
+        return
+    }
+    if findSection(exam, section) == nil {
+        http.Error(w, "Section not found", http.StatusNotFound)
+        return
+    }
+    if _, submitted := session.SubmittedSections[section]; submitted {
+        http.Error(w, "Section already submitted", http.StatusConflict)
+        return
+    }
+
+    score := 0
+    for i := range session.QuestionIDs {
+        if q, ok := servedQuestion(session, i); ok && q.Section == section {
+            score += answerPoints(cfg, q, session.Answers[strconv.Itoa(i)])
+        }
+    }
+    if session.SubmittedSections == nil {
+        session.SubmittedSections = make(map[string]int)
+    }
+    session.SubmittedSections[section] = score
+
+    remaining := false
+    for i := range session.QuestionIDs {
+        if _, ok := servedQuestion(session, i); ok && !sectionLocked(session, i) {
+            remaining = true
+            break
+        }
+    }
+    if remaining {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "sectionScore": score})
+        return
+    }
+
+    result := finishAttempt(cfg, username, session.Answers, EndSubmitted, clientIP(cfg, r))
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "sectionScore": score, "finished": true, "score": result.Score, "sections": result.SectionScores, "receipt": newReceipt(cfg, result)})
+}
+
+// API endpoint saving a single answer as the student goes, so a disconnect
+// doesn't lose it
+func saveAnswerHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+    index, err := strconv.Atoi(r.FormValue("index"))
+    if err != nil || index < 0 {
+        http.Error(w, "Invalid question index", http.StatusBadRequest)
+        return
+    }
+    answer := r.FormValue("answer")
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok || session.Terminated {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    if index >= userQuestionIndex[username] {
+        http.Error(w, "Question has not been served", http.StatusBadRequest)
+        return
+    }
+    if sectionLocked(session, index) {
+        http.Error(w, "Section already submitted", http.StatusConflict)
+        return
+    }
+    if bankExpired(session, time.Now()) {
+        http.Error(w, "Time bank exhausted", http.StatusForbidden)
+        return
+    }
+    if answerTimeUp(session, strconv.Itoa(index), time.Now()) {
+        http.Error(w, "Time for this question is up", http.StatusForbidden)
+        return
+    }
+
+    if q, ok := servedQuestion(session, index); ok {
+        answer = submittedAnswer(cfg, findExam(session.ExamID), q, answer)
+    }
+
+    recordAnswerChange(session, strconv.Itoa(index), answer, time.Now())
+    session.Answers[strconv.Itoa(index)] = answer
+    session.LastActivity = time.Now()
+    recordAnswerTime(session, strconv.Itoa(index), session.LastActivity)
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true"})
+}
+
+// API endpoint discarding a student's unsubmitted attempt so the next visit to
+// /proctor starts a fresh one. Questions are served in the exam's fixed order,
+// so there is no per-student order or seed to regenerate; the fresh attempt
+// starts from the first question with no answers.
+func regenerateAttemptHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    for _, res := range results {
+        if res.Username == username && res.ExamID == examID {
+            http.Error(w, "Student has already submitted this exam", http.StatusConflict)
+            return
+        }
+    }
+
+    session, ok := examSessions[username]
+    if !ok || session.ExamID != examID {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+
+    delete(examSessions, username)
+    delete(userQuestionIndex, username)
+    delete(userQuestionIDs, username)
+    recordAudit(admin, "regenerate-attempt", fmt.Sprintf("%s exam %d", username, examID))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"success": "true", "message": "Attempt reset"})
+}
+
+// Wrong access codes a student may enter in a row before being locked out
+// for accessCodeLockoutTime, so short codes cannot be guessed
+const (
+    maxAccessCodeFailures = 5
+    accessCodeLockoutTime = 5 * time.Minute
+)
+
+// accessCodeFailure counts a student's wrong access codes in a row.
+type accessCodeFailure struct {
+    Count       int
+    LockedUntil time.Time
+}
+
+// Wrong access code streaks keyed by username
+var accessCodeFailures = make(map[string]*accessCodeFailure)
+
+// accessCodeLockout returns how much longer username is locked out of
+// entering access codes at now, or zero. Caller must hold mu.
+func accessCodeLockout(username string, now time.Time) time.Duration {
+    f, ok := accessCodeFailures[username]
+    if !ok || !now.Before(f.LockedUntil) {
+        return 0
+    }
+    return f.LockedUntil.Sub(now)
+}
+
+// recordAccessCodeFailure counts a wrong access code from username, locking
+// them out once maxAccessCodeFailures are reached. It returns the length of
+// the streak. Caller must hold mu.
+func recordAccessCodeFailure(username string, now time.Time) int {
+    f, ok := accessCodeFailures[username]
+    if !ok {
+        f = &accessCodeFailure{}
+        accessCodeFailures[username] = f
+    }
+    f.Count++
+    if f.Count%maxAccessCodeFailures == 0 {
+        f.LockedUntil = now.Add(accessCodeLockoutTime)
+    }
+    return f.Count
+}
+
+// API endpoint recording that a student has read the exam instructions and
+// is starting, with the exam's access code if it has one. Repeated calls keep
+// the first start time.
+func startExamHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.FormValue("username")
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok || session.Terminated {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    if session.AcknowledgedAt.IsZero() {
+        exam := findExam(session.ExamID)
+        if exam != nil && exam.AccessCode != "" {
+            now := time.Now()
+            if wait := accessCodeLockout(username, now); wait > 0 {
+                w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+                http.Error(w, "Too many wrong access codes; try again later", http.StatusTooManyRequests)
+                return
+            }
+            if !checkPassword(exam.AccessCode, strings.TrimSpace(r.FormValue("code"))) {
+                failures := recordAccessCodeFailure(username, now)
+                recordAudit(username, "access-code-failed", fmt.Sprintf("exam %d from %s, %d in a row", exam.ID, clientIP(cfg, r), failures))
+                http.Error(w, "Invalid access code", http.StatusForbidden)
+                return
+            }
+            delete(accessCodeFailures, username)
+        }
+        acknowledgeStart(session, time.Now())
+    }
+    session.LastActivity = time.Now()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "startedAt": session.AcknowledgedAt, "submitAllowedAt": submitAllowedAt(session)})
+}
+
+// API endpoint listing everyone currently taking an exam
+func activeSessionsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    type activeSession struct {
+        Username       string
+        ExamID         int
+        ExamTitle      string
+        StartedAt      time.Time
+        QuestionIndex  int
+        ViolationCount int
+        Online         bool
+    }
+
+    now := time.Now()
+
+    mu.Lock()
+    list := make([]activeSession, 0, len(examSessions))
+    for username, session := range examSessions {
+        title := ""
+        if exam := findExam(session.ExamID); exam != nil {
+            title = exam.Title
+        }
+        list = append(list, activeSession{
+            Username:       username,
+            ExamID:         session.ExamID,
+            ExamTitle:      title,
+            StartedAt:      session.StartedAt,
+            QuestionIndex:  userQuestionIndex[username],
+            ViolationCount: examViolationCount(username, session.ExamID),
+            Online:         online(cfg, session, now),
+        })
+    }
+    mu.Unlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.Before(list[j].StartedAt) })
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
+
+// API endpoint listing, for a student's attempt, which questions are answered
+// and with what. It never says whether an answer is correct.
+func reviewBeforeSubmitHandler(w http.ResponseWriter, r *http.Request) {
+    type reviewItem struct {
+        Index    int
+        Section  string
+        Served   bool
+        Answered bool
+        Answer   string `json:",omitempty"`
+    }
+
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok || session.Terminated {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+
+    items := make([]reviewItem, 0, len(session.QuestionIDs))
+    for i := range session.QuestionIDs {
+        q, ok := servedQuestion(session, i)
+        if !ok {
+            continue // Deleted from the bank; it is skipped and not graded
+        }
+        answer, answered := session.Answers[strconv.Itoa(i)]
+        items = append(items, reviewItem{
+            Index:    i,
+            Section:  q.Section,
+            Served:   i < userQuestionIndex[username],
+            Answered: answered && answer != "",
+            Answer:   answer,
+        })
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(items)
+}
+
+// API endpoint serving the student's next ?count= questions at once, for
+// clients that prefer fewer round trips. Questions served here advance the
+// student exactly as /get-next-question does, so they are never served
+// again. Outside a time bank each one gets a deadline as if they were
+// answered in turn, and answers after it are not accepted.
+func batchQuestionsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+    count, err := strconv.Atoi(r.URL.Query().Get("count"))
+    if err != nil || count < 1 || count > maxQuestionBatch {
+        http.Error(w, fmt.Sprintf("Count must be between 1 and %d", maxQuestionBatch), http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    session, ok := examSessions[username]
+    if !ok {
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    if blocked := questionsBlocked(cfg, session); blocked != nil {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(blocked)
+        return
+    }
+    exam := findExam(session.ExamID)
+
+    now := time.Now()
+    bankLeft := 0
+    if !session.BankDeadline.IsZero() {
+        bankLeft = int(bankRemaining(session, now).Seconds())
+        if bankLeft <= 0 {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(map[string]string{"status": "exam_over"})
+            return
+        }
+    }
+
+    lang := r.URL.Query().Get("lang")
+    if lang == "" {
+        lang = studentLanguage(username)
+    }
+
+    batch := []StudentQuestion{}
+    deadline := now
+    for len(batch) < count {
+        index := nextQuestionIndex(username, session, session.QuestionIDs)
+        if index >= len(session.QuestionIDs) {
+            break
+        }
+        served := serveQuestion(username, session, exam, session.QuestionIDs, index, lang)
+        served.BankRemaining = bankLeft
+        if session.BankDeadline.IsZero() {
+            deadline = deadline.Add(time.Duration(served.Time) * time.Second)
+            if session.AnswerDeadlines == nil {
+                session.AnswerDeadlines = make(map[string]time.Time)
+            }
+            session.AnswerDeadlines[strconv.Itoa(index)] = deadline
+        }
+        batch = append(batch, served)
+    }
+    if len(batch) == 0 {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"status": "exam_over"})
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"questions": batch})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestDeleteQuestionDuringAttempt(t *testing.T) {
+    resetState(t, 4)
+    startAttempt(t, "alice", 1)
+
+    if q := nextQuestion(t, "alice"); q.ID != 1 || q.Index != 0 {
+        t.Fatalf("first question: got ID %d at %d, want 1 at 0", q.ID, q.Index)
+    }
+
+    // Delete the question on screen and one not yet served.
+    for _, id := range []string{"1", "3"} {
+        w := serve(deleteQuestionHandler, "/delete-question", url.Values{"id": {id}, "force": {"true"}})
+        if w.Code != 200 {
+            t.Fatalf("deleting question %s: %d %s", id, w.Code, w.Body.String())
+        }
+    }
+
+    // The attempt keeps its positions: no question is skipped or repeated,
+    // and the deleted one is passed over.
+    if q := nextQuestion(t, "alice"); q.ID != 2 || q.Index != 1 {
+        t.Fatalf("after deleting: got ID %d at %d, want 2 at 1", q.ID, q.Index)
+    }
+    if q := nextQuestion(t, "alice"); q.ID != 4 || q.Index != 3 {
+        t.Fatalf("after skipping: got ID %d at %d, want 4 at 3", q.ID, q.Index)
+    }
+    w := serve(withConfig(testConfig, getNextQuestionHandler), "/get-next-question?user=alice", nil)
+    if body := w.Body.String(); !strings.Contains(body, "exam_over") {
+        t.Fatalf("after the last question: %s", body)
+    }
+
+    // Answers are keyed by position, so the ones to questions still in the
+    // bank are graded against the right questions.
+    resp := submit(t, "alice", map[string]string{"0": "0", "1": "0", "3": "1"})
+    if score, _ := resp["score"].(float64); score != 1 {
+        t.Errorf("score = %v, want 1", resp["score"])
+    }
+}
+
+func TestAddQuestionDuringAttempt(t *testing.T) {
+    for _, withSession := range []bool{true, false} {
+        resetState(t, 3)
+        if withSession {
+            startAttempt(t, "alice", 1)
+        }
+        if q := nextQuestion(t, "alice"); q.ID != 1 {
+            t.Fatalf("first question: got ID %d, want 1", q.ID)
+        }
+
+        // An admin adds questions while alice works through the rest.
+        done := make(chan struct{})
+        go func() {
+            defer close(done)
+            for i := 0; i < 20; i++ {
+                w := serve(withConfig(testConfig, addQuestionHandler), "/add-question", url.Values{
+                    "question": {"Added"},
+                    "options":  {"a,b"},
+                    "answer":   {"b"},
+                    "time":     {"30"},
+                })
+                if !strings.Contains(w.Body.String(), `"success":"true"`) {
+                    t.Errorf("adding a question: %s", w.Body.String())
+                    return
+                }
+            }
+        }()
+        for _, want := range []int{2, 3} {
+            if q := nextQuestion(t, "alice"); q.ID != want {
+                t.Errorf("session %v: got question %d, want %d", withSession, q.ID, want)
+            }
+        }
+        w := serve(withConfig(testConfig, getNextQuestionHandler), "/get-next-question?user=alice", nil)
+        if body := w.Body.String(); !strings.Contains(body, "exam_over") {
+            t.Errorf("session %v: added question served: %s", withSession, body)
+        }
+        resp := submit(t, "alice", map[string]string{"0": "0", "1": "0", "2": "0"})
+        <-done
+
+        if score, _ := resp["score"].(float64); score != 3 {
+            t.Errorf("session %v: score = %v, want 3", withSession, resp["score"])
+        }
+        mu.Lock()
+        ids := results[len(results)-1].QuestionIDs
+        mu.Unlock()
+        if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+            t.Errorf("session %v: graded questions %v, want [1 2 3]", withSession, ids)
+        }
+    }
+}
+
+func TestRemainingTimePerQuestion(t *testing.T) {
+    resetState(t, 2)
+    startAttempt(t, "alice", 1)
+    remaining := func() int {
+        return serve(remainingTimeHandler, "/api/remaining?user=alice&exam=1", nil).Code
+    }
+    expire := func() {
+        mu.Lock()
+        session := examSessions["alice"]
+        for key, servedAt := range session.ServedAt {
+            session.ServedAt[key] = servedAt.Add(-time.Hour)
+        }
+        mu.Unlock()
+    }
+
+    // An expired question that is not the last leaves the exam running.
+    nextQuestion(t, "alice")
+    expire()
+    if code := remaining(); code != 200 {
+        t.Fatalf("first question expired: got %d, want 200", code)
+    }
+
+    nextQuestion(t, "alice")
+    if code := remaining(); code != 200 {
+        t.Fatalf("last question running: got %d, want 200", code)
+    }
+    expire()
+    if code := remaining(); code != 410 {
+        t.Errorf("last question expired: got %d, want 410", code)
+    }
+}
+
+func TestIdleSweepGradesSavedAnswers(t *testing.T) {
+    resetState(t, 2)
+    startAttempt(t, "alice", 1)
+    nextQuestion(t, "alice")
+    w := serve(withConfig(testConfig, saveAnswerHandler), "/save-answer", url.Values{"username": {"alice"}, "index": {"0"}, "answer": {"0"}})
+    if w.Code != 200 {
+        t.Fatalf("saving an answer: %d %s", w.Code, w.Body.String())
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    exams[0].IdleTimeoutMinutes = 5
+    sweepIdleSessions(testConfig, time.Now().Add(10*time.Minute))
+    if _, active := examSessions["alice"]; active {
+        t.Fatal("idle session was not ended")
+    }
+    if len(results) != 1 {
+        t.Fatalf("%d results, want 1", len(results))
+    }
+    if res := results[0]; res.EndReason != EndAbandoned || res.Score != 1 {
+        t.Errorf("got %s with score %d, want %s with score 1", res.EndReason, res.Score, EndAbandoned)
+    }
+}
+
+func TestSubmitTerminatedSession(t *testing.T) {
+    resetState(t, 2)
+    startAttempt(t, "alice", 1)
+    nextQuestion(t, "alice")
+    serve(withConfig(testConfig, saveAnswerHandler), "/save-answer", url.Values{"username": {"alice"}, "index": {"0"}, "answer": {"0"}})
+    mu.Lock()
+    examSessions["alice"].Terminated = true
+    mu.Unlock()
+
+    // Answers sent after termination don't count.
+    resp := submit(t, "alice", map[string]string{"0": "0", "1": "0"})
+    if score, _ := resp["score"].(float64); score != 1 {
+        t.Errorf("score = %v, want 1 from the saved answer", resp["score"])
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if len(results) != 1 || results[0].EndReason != EndTerminated {
+        t.Errorf("results %+v, want one ended as %s", results, EndTerminated)
+    }
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+)
+
+// similarityMethod describes how similarityHandler scores a pair, for the
+// response.
+const similarityMethod = "For each pair of students, the number of questions both answered " +
+    "with the same incorrect answer, divided by the number of questions either answered " +
+    "incorrectly. 1 means every wrong answer was shared. Each student's latest result is used; " +
+    "unanswered questions and questions since deleted are ignored."
+
+// maxSimilarPairs is how many of the most similar pairs are reported.
+const maxSimilarPairs = 50
+
+// SimilarPair is two students whose wrong answers overlap.
+type SimilarPair struct {
+    StudentA    string
+    StudentB    string
+    SharedWrong int
+    EitherWrong int
+    Similarity  float64
+    QuestionIDs []int // Questions with the shared wrong answers
+}
+
+type similarityReport struct {
+    results int // How many results the exam had when computed
+    pairs   []SimilarPair
+}
+
+// Computed similarity reports keyed by exam ID, reused until the exam gets
+// another result
+var similarityCache = make(map[int]similarityReport)
+
+// API endpoint ranking the pairs of students who took an exam by how many
+// incorrect answers they share
+func similarityHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    if findExam(id) == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+    count := 0
+    latest := make(map[string]Result)
+    for _, res := range results {
+        if res.ExamID == id {
+            count++
+            latest[res.Username] = res
+        }
+    }
+    report, cached := similarityCache[id]
+    if !cached || report.results != count {
+        // Only the wrong answers are needed; work them out while the bank
+        // can't change.
+        wrong := make(map[string]map[int]string, len(latest))
+        for username, res := range latest {
+            wrong[username] = wrongAnswers(cfg, res)
+        }
+        mu.Unlock()
+
+        report = similarityReport{results: count, pairs: similarPairs(wrong)}
+
+        mu.Lock()
+        similarityCache[id] = report
+    }
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "method": similarityMethod,
+        "pairs":  report.pairs,
+    })
+}
+
+// wrongAnswers returns res's incorrect answers keyed by question ID, each
+// normalized so trivially different spellings compare equal. Caller must
+// hold mu.
+func wrongAnswers(cfg *Config, res Result) map[int]string {
+    wrong := make(map[int]string)
+    for qid, answer := range res.Answers {
+        q := findQuestion(qid)
+        if q == nil || q.ManualGrading || answer == "" || answerCorrect(cfg, *q, answer) {
+            continue
+        }
+        wrong[qid] = normalizeAnswer(cfg, answer)
+    }
+    return wrong
+}
+
+// similarPairs scores every pair of students by their wrong answers and
+// returns the most similar, highest first.
+func similarPairs(wrong map[string]map[int]string) []SimilarPair {
+    usernames := make([]string, 0, len(wrong))
+    for username := range wrong {
+        usernames = append(usernames, username)
+    }
+    sort.Strings(usernames)
+
+    pairs := []SimilarPair{}
+    for i, a := range usernames {
+        for _, b := range usernames[i+1:] {
+            var shared []int
+            either := len(wrong[a])
+            for qid, answer := range wrong[b] {
+                other, ok := wrong[a][qid]
+                if !ok {
+                    either++
+                } else if other == answer {
+                    shared = append(shared, qid)
+                }
+            }
+            if len(shared) == 0 {
+                continue
+            }
+            sort.Ints(shared)
+            pairs = append(pairs, SimilarPair{
+                StudentA:    a,
+                StudentB:    b,
+                SharedWrong: len(shared),
+                EitherWrong: either,
+                Similarity:  float64(len(shared)) / float64(either),
+                QuestionIDs: shared,
+            })
+        }
+    }
+    sort.SliceStable(pairs, func(i, j int) bool {
+        if pairs[i].Similarity != pairs[j].Similarity {
+            return pairs[i].Similarity > pairs[j].Similarity
+        }
+        return pairs[i].SharedWrong > pairs[j].SharedWrong
+    })
+    if len(pairs) > maxSimilarPairs {
+        pairs = pairs[:maxSimilarPairs]
+    }
+    return pairs
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+)
+
+const dataDir = "data"
+
+// saveJSON atomically writes v as JSON to name inside the data directory.
+func saveJSON(name string, v interface{}) error {
+    body, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return err
+    }
+
+    if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+        return err
+    }
+
+    path := filepath.Join(dataDir, name)
+    tmp := path + ".tmp"
+    if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+// loadJSON reads name from the data directory into v. A missing file is
+// reported with os.IsNotExist.
+func loadJSON(name string, v interface{}) error {
+    body, err := ioutil.ReadFile(filepath.Join(dataDir, name))
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(body, v)
+}
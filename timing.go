@@ -0,0 +1,104 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+)
+
+// AnswerTiming records how long a student took to answer one question.
+type AnswerTiming struct {
+    Index      int // Position the question was served at
+    QuestionID int
+    ServedAt   time.Time
+    AnsweredAt time.Time
+    Seconds    float64
+    // Fast is set when the answer came in under Config.FastAnswerSeconds.
+    Fast bool
+}
+
+// recordAnswerTime notes that the answer at index was saved at now. Only
+// questions that were actually served are timed. Caller must hold mu.
+func recordAnswerTime(session *ExamSession, index string, now time.Time) {
+    if _, served := session.ServedAt[index]; served {
+        session.AnsweredAt[index] = now
+    }
+}
+
+// answerTimings lists the session's timed answers in served order. Caller
+// must hold mu.
+func answerTimings(cfg *Config, session *ExamSession) []AnswerTiming {
+    timings := []AnswerTiming{}
+    for key, answeredAt := range session.AnsweredAt {
+        index, err := strconv.Atoi(key)
+        if err != nil {
+            continue
+        }
+        t := AnswerTiming{
+            Index:      index,
+            ServedAt:   session.ServedAt[key],
+            AnsweredAt: answeredAt,
+            Seconds:    answeredAt.Sub(session.ServedAt[key]).Seconds(),
+        }
+        if index >= 0 && index < len(session.QuestionIDs) {
+            t.QuestionID = session.QuestionIDs[index]
+        }
+        t.Fast = cfg.FastAnswerSeconds > 0 && t.Seconds < float64(cfg.FastAnswerSeconds)
+        timings = append(timings, t)
+    }
+    sort.Slice(timings, func(i, j int) bool { return timings[i].Index < timings[j].Index })
+    return timings
+}
+
+// API endpoint reporting how long a student spent on each answer, from the
+// active session or else their submitted result
+func answerTimingsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    var timings []AnswerTiming
+    found := false
+    if session, ok := examSessions[username]; ok && session.ExamID == examID {
+        timings, found = answerTimings(cfg, session), true
+    } else {
+        for i := len(results) - 1; i >= 0; i-- {
+            if results[i].Username == username && results[i].ExamID == examID {
+                timings, found = results[i].AnswerTimings, true
+                break
+            }
+        }
+    }
+    if !found {
+        http.Error(w, "No attempt found", http.StatusNotFound)
+        return
+    }
+
+    fast := 0
+    for _, t := range timings {
+        if t.Fast {
+            fast++
+        }
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "username":          username,
+        "examId":            examID,
+        "fastAnswerSeconds": cfg.FastAnswerSeconds,
+        "fastAnswers":       fast,
+        "timings":           timings,
+    })
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// validateQuestion returns the problems that would stop q from being served
+// and graded correctly, or nil if there are none.
+func validateQuestion(cfg *Config, q Question) []string {
+    var problems []string
+
+    if strings.TrimSpace(q.Text) == "" {
+        problems = append(problems, "question text is empty")
+    }
+    if q.Time <= 0 {
+        problems = append(problems, "time must be positive")
+    }
+
+    if q.ManualGrading && q.Type != QuestionShortAnswer {
+        problems = append(problems, "only short answer questions can be graded by hand")
+    }
+    if q.MaxPoints < 0 {
+        problems = append(problems, "max points must not be negative")
+    }
+
+    switch q.Type {
+    case "", QuestionMultipleChoice:
+    case QuestionShortAnswer:
+        if !q.ManualGrading && strings.TrimSpace(q.Answer) == "" {
+            problems = append(problems, "answer is empty")
+        }
+        return problems
+    case QuestionNumeric:
+        // ParseFloat accepts "NaN" and "Inf", which no answer can match.
+        key, err := strconv.ParseFloat(strings.TrimSpace(q.Answer), 64)
+        if err != nil || math.IsNaN(key) || math.IsInf(key, 0) {
+            problems = append(problems, "answer is not a finite number")
+        }
+        if q.Tolerance < 0 || math.IsNaN(q.Tolerance) || math.IsInf(q.Tolerance, 0) {
+            problems = append(problems, "tolerance must be a finite number, not negative")
+        }
+        return problems
+    case QuestionOrdering:
+        if len(q.Options) < 2 {
+            problems = append(problems, "fewer than two items to order")
+        }
+        if len(q.Options) > cfg.MaxOptions {
+            problems = append(problems, fmt.Sprintf("more than %d items to order", cfg.MaxOptions))
+        }
+        order, ok := parseIndexList(q.Answer)
+        if !ok || len(order) != len(q.Options) || !isPermutation(order) {
+            problems = append(problems, "answer must list every item index once, in the correct order")
+        }
+        return problems
+    case QuestionMatching:
+        if len(q.Options) < 2 {
+            problems = append(problems, "fewer than two items to match")
+        }
+        if len(q.Options) > cfg.MaxOptions {
+            problems = append(problems, fmt.Sprintf("more than %d items to match", cfg.MaxOptions))
+        }
+        if len(q.Matches) < len(q.Options) {
+            problems = append(problems, "fewer matches than items")
+        }
+        pairs, ok := parseIndexList(q.Answer)
+        if !ok || len(pairs) != len(q.Options) {
+            problems = append(problems, "answer must give a match index for every item")
+        } else {
+            for i, m := range pairs {
+                if m < 0 || m >= len(q.Matches) {
+                    problems = append(problems, fmt.Sprintf("item %d is matched to unknown match %d", i, m))
+                }
+            }
+        }
+        return problems
+    default:
+        return append(problems, fmt.Sprintf("unknown question type %q", q.Type))
+    }
+
+    if len(q.Options) < cfg.MinOptions || len(q.Options) > cfg.MaxOptions {
+        problems = append(problems, fmt.Sprintf("has %d options; between %d and %d are allowed", len(q.Options), cfg.MinOptions, cfg.MaxOptions))
+    }
+    // Answers may name an option by its text, so no two may read the same.
+    seen := make(map[string]int)
+    for i, option := range q.Options {
+        if option == "" {
+            problems = append(problems, fmt.Sprintf("option %d is empty", i))
+            continue
+        }
+        if j, dup := seen[normalizeAnswer(cfg, option)]; dup {
+            problems = append(problems, fmt.Sprintf("options %d and %d are the same", j, i))
+        } else {
+            seen[normalizeAnswer(cfg, option)] = i
+        }
+    }
+
+    answer := strings.TrimSpace(q.Answer)
+    if answer == "" {
+        problems = append(problems, "answer is empty")
+    } else if !answerInOptions(cfg, answer, q.Options) {
+        problems = append(problems, "answer is not one of the options")
+    }
+
+    return problems
+}
+
+// isPermutation reports whether list holds each of 0..len(list)-1 once.
+func isPermutation(list []int) bool {
+    seen := make([]bool, len(list))
+    for _, v := range list {
+        if v < 0 || v >= len(list) || seen[v] {
+            return false
+        }
+        seen[v] = true
+    }
+    return true
+}
+
+// answerInOptions reports whether a stored answer key names one of options,
+// read as grading reads it.
+func answerInOptions(cfg *Config, answer string, options []string) bool {
+    _, ok := optionIndex(cfg, answer, options)
+    return ok
+}
+
+// examProblems returns the reasons exam is not ready to be opened to
+// students. Caller must hold mu.
+func examProblems(cfg *Config, exam *Exam) []string {
+    problems := []string{}
+    examQs := examQuestions(exam)
+    if len(examQs) == 0 {
+        problems = append(problems, "exam has no questions")
+    }
+    for _, section := range exam.Sections {
+        empty := true
+        for _, q := range examQs {
+            if q.Section == section.Name {
+                empty = false
+                break
+            }
+        }
+        if empty {
+            problems = append(problems, fmt.Sprintf("section %q has no questions", section.Name))
+        }
+    }
+    if exam.TimingMode == TimingTimeBank {
+        bank := 0
+        for _, q := range examQs {
+            bank += q.Time
+        }
+        if bank <= 0 {
+            problems = append(problems, "time bank is empty")
+        }
+    }
+    for _, q := range examQs {
+        for _, problem := range validateQuestion(cfg, q) {
+            problems = append(problems, fmt.Sprintf("question %d: %s", q.ID, problem))
+        }
+    }
+    return problems
+}
+
+// logExamProblems warns at startup about every exam that is not ready.
+func logExamProblems(cfg *Config) {
+    mu.Lock()
+    defer mu.Unlock()
+
+    for i := range exams {
+        for _, problem := range examProblems(cfg, &exams[i]) {
+            log.Printf("exam %d (%s): %s", exams[i].ID, exams[i].Title, problem)
+        }
+    }
+}
+
+// API endpoint checking an exam is ready to be opened to students
+func validateExamHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    exam := findExam(id)
+    if exam == nil {
+        mu.Unlock()
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    problems := examProblems(cfg, exam)
+    mu.Unlock()
+
+    status := "ok"
+    if len(problems) > 0 {
+        status = "invalid"
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "problems": problems})
+}
+
+// API endpoint listing every question in the bank that fails validation,
+// with the reasons it failed
+func invalidQuestionsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    type invalidQuestion struct {
+        ID       int
+        Text     string
+        Problems []string
+    }
+
+    mu.Lock()
+    list := []invalidQuestion{}
+    for _, q := range questions {
+        if problems := validateQuestion(cfg, q); len(problems) > 0 {
+            list = append(list, invalidQuestion{ID: q.ID, Text: q.Text, Problems: problems})
+        }
+    }
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(list)
+}
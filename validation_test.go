@@ -0,0 +1,116 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+// distinctOptions returns n distinct option texts.
+func distinctOptions(n int) []string {
+    opts := make([]string, n)
+    for i := range opts {
+        opts[i] = fmt.Sprintf("option %d", i)
+    }
+    return opts
+}
+
+// identity returns the index list 0,1,...,n-1.
+func identity(n int) string {
+    list := make([]string, n)
+    for i := range list {
+        list[i] = fmt.Sprint(i)
+    }
+    return strings.Join(list, ",")
+}
+
+func TestOptionCountLimits(t *testing.T) {
+    oldMin, oldMax := testConfig.MinOptions, testConfig.MaxOptions
+    defer func() { testConfig.MinOptions, testConfig.MaxOptions = oldMin, oldMax }()
+
+    for _, limits := range [][2]int{{2, 10}, {3, 5}} {
+        testConfig.MinOptions, testConfig.MaxOptions = limits[0], limits[1]
+        tests := []struct {
+            n    int
+            want bool
+        }{
+            {testConfig.MinOptions - 1, false},
+            {testConfig.MinOptions, true},
+            {testConfig.MaxOptions, true},
+            {testConfig.MaxOptions + 1, false},
+        }
+        for _, tt := range tests {
+            q := Question{Text: "Which?", Options: distinctOptions(tt.n), Answer: "0", Time: 30}
+            problems := validateQuestion(testConfig, q)
+            if ok := len(problems) == 0; ok != tt.want {
+                t.Errorf("limits %d-%d, %d options: problems %v, want valid %v", testConfig.MinOptions, testConfig.MaxOptions, tt.n, problems, tt.want)
+            }
+        }
+
+        for _, typ := range []string{QuestionOrdering, QuestionMatching} {
+            for _, tt := range []struct {
+                n    int
+                want bool
+            }{{testConfig.MaxOptions, true}, {testConfig.MaxOptions + 1, false}} {
+                q := Question{Type: typ, Text: "Arrange", Options: distinctOptions(tt.n), Matches: distinctOptions(tt.n), Answer: identity(tt.n), Time: 30}
+                problems := validateQuestion(testConfig, q)
+                if ok := len(problems) == 0; ok != tt.want {
+                    t.Errorf("limits %d-%d, %s with %d items: problems %v, want valid %v", testConfig.MinOptions, testConfig.MaxOptions, typ, tt.n, problems, tt.want)
+                }
+            }
+        }
+    }
+}
+
+func TestAddQuestionOptionCount(t *testing.T) {
+    resetState(t, 0)
+    for _, tt := range []struct {
+        n    int
+        want bool
+    }{
+        {testConfig.MinOptions - 1, false},
+        {testConfig.MinOptions, true},
+        {testConfig.MaxOptions, true},
+        {testConfig.MaxOptions + 1, false},
+    } {
+        w := serve(withConfig(testConfig, addQuestionHandler), "/add-question", url.Values{
+            "question": {"Which?"},
+            "options":  {strings.Join(distinctOptions(tt.n), ",")},
+            "answer":   {"0"},
+            "time":     {"30"},
+        })
+        body := w.Body.String()
+        if ok := strings.Contains(body, `"success":"true"`); ok != tt.want {
+            t.Errorf("%d options: %s", tt.n, body)
+        }
+        if !tt.want && !strings.Contains(body, fmt.Sprintf("has %d options", tt.n)) {
+            t.Errorf("%d options: no clear message: %s", tt.n, body)
+        }
+    }
+}
+
+func TestNumericKeyMustBeFinite(t *testing.T) {
+    tests := []struct {
+        answer    string
+        tolerance float64
+        want      bool
+    }{
+        {"3.14", 0.01, true},
+        {"-2", 0, true},
+        {"NaN", 0, false},
+        {"Inf", 0, false},
+        {"-Infinity", 0, false},
+        {"3", math.NaN(), false},
+        {"3", math.Inf(1), false},
+        {"3", -1, false},
+    }
+    for _, tt := range tests {
+        q := Question{Type: QuestionNumeric, Text: "How many?", Answer: tt.answer, Tolerance: tt.tolerance, Time: 30}
+        problems := validateQuestion(testConfig, q)
+        if ok := len(problems) == 0; ok != tt.want {
+            t.Errorf("answer %q, tolerance %v: problems %v, want valid %v", tt.answer, tt.tolerance, problems, tt.want)
+        }
+    }
+}
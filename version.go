@@ -0,0 +1,29 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+)
+
+// Build information, set at compile time with
+//
+//  go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var (
+    version   = "dev"
+    commit    = "dev"
+    buildTime = "dev"
+)
+
+// API endpoint reporting which build is running
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "version":   version,
+        "commit":    commit,
+        "buildTime": buildTime,
+    })
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ViolationEvent is a single violation report, kept alongside the per-user totals.
+type ViolationEvent struct {
+    ID        int
+    Username  string
+    ExamID    int
+    Type      string
+    Detail    string
+    Weight    int
+    Time      time.Time
+    ImagePath string // Capture that triggered the violation, if any
+    // Duration is how long focus was away for tab and window changes that
+    // reported it.
+    Duration time.Duration `json:",omitempty"`
+    // Simulated marks events raised by /api/simulate-violation to test the
+    // pipeline. Reports leave them out and they can be purged.
+    Simulated bool `json:",omitempty"`
+}
+
+var violationEvents []ViolationEvent
+var violationIDCounter = 1
+
+const violationsFile = "violations.json"
+
+// savedViolations is the on-disk form of the violation totals and events.
+type savedViolations struct {
+    Violations []Violation
+    Events     []ViolationEvent
+    IDCounter  int
+}
+
+// loadViolations reads the persisted violation totals and events.
+func loadViolations() {
+    mu.Lock()
+    defer mu.Unlock()
+
+    var saved savedViolations
+    if err := loadJSON(violationsFile, &saved); err != nil {
+        if !os.IsNotExist(err) {
+            log.Fatalf("loading %s: %v", violationsFile, err)
+        }
+        return
+    }
+    violations = saved.Violations
+    violationEvents = saved.Events
+    violationIDCounter = nextIDAfter(saved.IDCounter, 0)
+    for _, e := range violationEvents {
+        violationIDCounter = nextIDAfter(violationIDCounter, e.ID)
+    }
+}
+
+// saveViolations writes the violation totals and events to disk, logging
+// any error. Caller must hold mu.
+func saveViolations() {
+    saved := savedViolations{Violations: violations, Events: violationEvents, IDCounter: violationIDCounter}
+    if err := saveJSON(violationsFile, saved); err != nil {
+        log.Printf("saving %s: %v", violationsFile, err)
+    }
+}
+
+// recordViolation adds a violation of the given type for username and returns
+// the user's weighted total and whether it has reached the limit of their
+// current exam.
+// A report inside the type's grace window is not counted again.
+// Caller must hold mu.
+func recordViolation(cfg *Config, username, violationType, detail, imagePath string) (int, bool) {
+    return addViolation(cfg, username, violationType, detail, imagePath, 0, false)
+}
+
+// addViolation is recordViolation for both real and simulated violations.
+// A non-zero duration is how long focus was lost and scales the weight by
+// Config.FocusLossSteps. Caller must hold mu.
+func addViolation(cfg *Config, username, violationType, detail, imagePath string, duration time.Duration, simulated bool) (int, bool) {
+    now := time.Now()
+
+    index := -1
+    for i, v := range violations {
+        if v.Username == username {
+            index = i
+            break
+        }
+    }
+    if index == -1 {
+        violations = append(violations, Violation{Username: username})
+        index = len(violations) - 1
+    }
+
+    examID := 0
+    if session, ok := examSessions[username]; ok {
+        examID = session.ExamID
+    }
+    limit := maxViolations(cfg, findExam(examID))
+
+    if grace := cfg.GraceWindows[violationType]; grace > 0 {
+        for i := len(violationEvents) - 1; i >= 0; i-- {
+            e := violationEvents[i]
+            if e.Username == username && e.Type == violationType {
+                if now.Sub(e.Time) < time.Duration(grace)*time.Second {
+                    count := examViolationCount(username, examID)
+                    return count, count >= limit
+                }
+                break
+            }
+        }
+    }
+
+    weight := violationWeight(cfg, violationType) * focusLossMultiplier(cfg, duration)
+    violationEvents = append(violationEvents, ViolationEvent{
+        ID:        violationIDCounter,
+        Username:  username,
+        ExamID:    examID,
+        Type:      violationType,
+        Detail:    detail,
+        Weight:    weight,
+        Time:      now,
+        ImagePath: imagePath,
+        Duration:  duration,
+        Simulated: simulated,
+    })
+    violationIDCounter++
+    violations[index].Count += weight
+    saveViolations()
+
+    // The limit is per exam, so violations from other exams don't count.
+    count := examViolationCount(username, examID)
+    terminated := count >= limit
+    if session, ok := examSessions[username]; ok && terminated {
+        session.Terminated = true
+    }
+    // Only the violation that crosses the limit notifies the proctor.
+    if terminated && count-weight < limit {
+        notifyMaxViolations(cfg, username, examID, count)
+    }
+    if cfg.ViolationWebhookURL != "" {
+        enqueueWebhook(cfg.ViolationWebhookURL, cfg.WebhookSecret, map[string]interface{}{
+            "event":     "violation",
+            "id":        violationIDCounter - 1,
+            "username":  username,
+            "examId":    examID,
+            "type":      violationType,
+            "detail":    detail,
+            "weight":    weight,
+            "count":     count,
+            "time":      now,
+            "simulated": simulated,
+        })
+    }
+    return count, terminated
+}
+
+// violationEnabled reports whether violations of the given type count for
+// username's current exam. Caller must hold mu.
+func violationEnabled(username, violationType string) bool {
+    session, ok := examSessions[username]
+    if !ok {
+        return true
+    }
+    exam := findExam(session.ExamID)
+    return exam == nil || !exam.DisabledViolations[violationType]
+}
+
+// userMaxViolations returns the violation limit for username's current exam.
+// Caller must hold mu.
+func userMaxViolations(cfg *Config, username string) int {
+    if session, ok := examSessions[username]; ok {
+        return maxViolations(cfg, findExam(session.ExamID))
+    }
+    return cfg.MaxViolations
+}
+
+// violationCount returns the weighted violation total for username.
+// Caller must hold mu.
+func violationCount(username string) int {
+    for _, v := range violations {
+        if v.Username == username {
+            return v.Count
+        }
+    }
+    return 0
+}
+
+// examViolationCount returns username's weighted violation total in one
+// exam, which is what that exam's limit applies to. Caller must hold mu.
+func examViolationCount(username string, examID int) int {
+    count := 0
+    for _, e := range violationEvents {
+        if e.Username == username && e.ExamID == examID {
+            count += e.Weight
+        }
+    }
+    return count
+}
+
+// writeViolation records a browser-reported violation and writes the
+// response the proctor page expects. duration is how long focus was lost,
+// zero when the page didn't report it.
+func writeViolation(cfg *Config, w http.ResponseWriter, username, violationType string, duration time.Duration) {
+    mu.Lock()
+    if !violationEnabled(username, violationType) {
+        mu.Unlock()
+        w.Write([]byte("OK"))
+        return
+    }
+    count, terminated := addViolation(cfg, username, violationType, "", "", duration, false)
+    mu.Unlock()
+
+    if terminated {
+        w.Write([]byte("MAX_VIOLATIONS"))
+        return
+    }
+    w.Write([]byte(fmt.Sprintf("VIOLATION:%s:%d", violationType, count)))
+}
+
+// focusLossDuration parses the optional duration form value, in seconds,
+// that the proctor page sends with tab and window changes. ok is false when
+// it is present but not a non-negative number.
+func focusLossDuration(r *http.Request) (d time.Duration, ok bool) {
+    v := r.FormValue("duration")
+    if v == "" {
+        return 0, true
+    }
+    seconds, err := strconv.ParseFloat(v, 64)
+    if err != nil || seconds < 0 || seconds > 24*60*60 {
+        return 0, false
+    }
+    return time.Duration(seconds * float64(time.Second)), true
+}
+
+// API endpoint exposing the violation and password settings the handlers
+// enforce. With ?exam= the capture settings are the ones for that exam.
+func examConfigHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET") {
+        return
+    }
+
+    var exam *Exam
+    mu.Lock()
+    if id, ok := examIDParam(r, "exam"); ok {
+        exam = findExam(id)
+    }
+    interval := captureInterval(cfg, exam)
+    maxGap := maxCaptureGap(cfg, exam)
+    limit := maxViolations(cfg, exam)
+    mu.Unlock()
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "maxViolations":    limit,
+        "violationWeights": cfg.ViolationWeights,
+        "focusLossSteps":   cfg.FocusLossSteps,
+        "graceWindows":     cfg.GraceWindows,
+        "captureInterval":  interval,
+        "maxCaptureGap":    int(maxGap.Seconds()),
+        "passwordPolicy":   cfg.PasswordPolicy,
+    })
+}
+
+// API endpoint telling a student how many violations remain before termination
+func violationsRemainingHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    username := r.URL.Query().Get("user")
+    if username == "" {
+        http.Error(w, "User not specified", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    session, ok := examSessions[username]
+    if !ok {
+        mu.Unlock()
+        http.Error(w, "No active exam session", http.StatusNotFound)
+        return
+    }
+    count := examViolationCount(username, session.ExamID)
+    limit := userMaxViolations(cfg, username)
+    mu.Unlock()
+
+    if session.Terminated || count >= limit {
+        http.Error(w, "Exam terminated", http.StatusForbidden)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]int{
+        "count":         count,
+        "maxViolations": limit,
+        "remaining":     limit - count,
+    })
+}
+
+// API endpoint to view (GET) or toggle (POST type, enabled) the violation
+// types an exam enforces
+func examViolationTypesHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "GET", "POST") {
+        return
+    }
+
+    id, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    exam := findExam(id)
+    if exam == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    if r.Method == "POST" {
+        violationType := r.FormValue("type")
+        if _, known := cfg.ViolationWeights[violationType]; !known {
+            http.Error(w, "Unknown violation type", http.StatusBadRequest)
+            return
+        }
+        enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+        if err != nil {
+            http.Error(w, "Invalid enabled value", http.StatusBadRequest)
+            return
+        }
+
+        if enabled {
+            delete(exam.DisabledViolations, violationType)
+        } else {
+            if exam.DisabledViolations == nil {
+                exam.DisabledViolations = make(map[string]bool)
+            }
+            exam.DisabledViolations[violationType] = true
+        }
+        if err := saveExams(); err != nil {
+            log.Printf("saving %s: %v", examsFile, err)
+        }
+    }
+
+    types := make(map[string]bool)
+    for violationType := range cfg.ViolationWeights {
+        types[violationType] = !exam.DisabledViolations[violationType]
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(types)
+}
+
+// API endpoint clearing every violation recorded in an exam, for example
+// after a detection bug. The removed events are archived to the data
+// directory first. It requires a "reset-violations-bulk" confirmation token.
+func resetViolationsBulkHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    examID, ok := examIDParam(r, "exam")
+    if !ok {
+        http.Error(w, "Invalid exam ID", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if !consumeConfirmation("reset-violations-bulk", r.URL.Query().Get("confirm")) {
+        http.Error(w, "Missing or invalid confirmation token", http.StatusForbidden)
+        return
+    }
+    if findExam(examID) == nil {
+        http.Error(w, "Exam not found", http.StatusNotFound)
+        return
+    }
+
+    var removed, kept []ViolationEvent
+    removedWeight := make(map[string]int)
+    for _, e := range violationEvents {
+        if e.ExamID == examID {
+            removed = append(removed, e)
+            removedWeight[e.Username] += e.Weight
+        } else {
+            kept = append(kept, e)
+        }
+    }
+
+    now := time.Now()
+    archive := fmt.Sprintf("violations-reset-exam%d-%s.json", examID, now.Format("20060102-150405"))
+    if err := saveJSON(archive, removed); err != nil {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "message": "Error archiving violations"})
+        return
+    }
+
+    violationEvents = kept
+    for i := range violations {
+        violations[i].Count -= removedWeight[violations[i].Username]
+        if violations[i].Count < 0 {
+            violations[i].Count = 0
+        }
+    }
+    // Students terminated by the cleared violations may carry on.
+    for username, session := range examSessions {
+        if session.ExamID == examID && session.Terminated && examViolationCount(username, examID) < maxViolations(cfg, findExam(examID)) {
+            session.Terminated = false
+        }
+    }
+    saveViolations()
+    recordAudit(admin, "reset-violations-bulk", fmt.Sprintf("exam %d: %d events from %d students, archived to %s", examID, len(removed), len(removedWeight), archive))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "studentsAffected": len(removedWeight), "eventsRemoved": len(removed), "archive": archive})
+}
+
+// API endpoint raising a simulated violation of ?type= for ?user=, to check
+// weights, limits, notifications and webhooks end to end. It counts like a
+// real one and may terminate the student's exam, so use a test account.
+func simulateViolationHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+
+    username := r.URL.Query().Get("user")
+    violationType := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("type")))
+    if username == "" || violationType == "" {
+        http.Error(w, "User and type are required", http.StatusBadRequest)
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if _, ok := studentUser[username]; !ok {
+        http.Error(w, "Student not found", http.StatusNotFound)
+        return
+    }
+    count, terminated := addViolation(cfg, username, violationType, "simulated by "+admin, "", 0, true)
+    recordAudit(admin, "simulate-violation", fmt.Sprintf("%s %s: total %d", username, violationType, count))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "count": count, "maxViolations": userMaxViolations(cfg, username), "terminated": terminated})
+}
+
+// API endpoint removing every simulated violation and taking its weight off
+// the students' totals. Students terminated only by simulated violations may
+// carry on.
+func purgeSimulatedViolationsHandler(cfg *Config, w http.ResponseWriter, r *http.Request) {
+    if !allowMethod(w, r, "POST") {
+        return
+    }
+    admin, _ := adminFromRequest(r)
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    var kept []ViolationEvent
+    removed := 0
+    removedWeight := make(map[string]int)
+    for _, e := range violationEvents {
+        if e.Simulated {
+            removed++
+            removedWeight[e.Username] += e.Weight
+        } else {
+            kept = append(kept, e)
+        }
+    }
+
+    violationEvents = kept
+    for i := range violations {
+        violations[i].Count -= removedWeight[violations[i].Username]
+        if violations[i].Count < 0 {
+            violations[i].Count = 0
+        }
+    }
+    for username, session := range examSessions {
+        if session.Terminated && removedWeight[username] > 0 && examViolationCount(username, session.ExamID) < maxViolations(cfg, findExam(session.ExamID)) {
+            session.Terminated = false
+        }
+    }
+    saveViolations()
+    recordAudit(admin, "purge-simulated-violations", fmt.Sprintf("%d events from %d students", removed, len(removedWeight)))
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "eventsRemoved": removed, "studentsAffected": len(removedWeight)})
+}
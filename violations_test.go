@@ -0,0 +1,39 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+func TestViolationLimitIsPerExam(t *testing.T) {
+    resetState(t, 1)
+    mu.Lock()
+    exams = []Exam{{ID: 1, MaxViolations: 10}, {ID: 2, MaxViolations: 20}}
+    // 12 points from an earlier quiz allowing 20.
+    violationEvents = []ViolationEvent{{ID: 1, Username: "alice", ExamID: 2, Type: "TAB_CHANGE", Weight: 12}}
+    violations = []Violation{{Username: "alice", Count: 12}}
+    mu.Unlock()
+    startAttempt(t, "alice", 1)
+
+    w := serve(withConfig(testConfig, violationsRemainingHandler), "/api/violations-remaining?user=alice", nil)
+    var remaining map[string]int
+    if err := json.Unmarshal(w.Body.Bytes(), &remaining); err != nil {
+        t.Fatalf("violations remaining: %d %s", w.Code, w.Body.String())
+    }
+    if remaining["count"] != 0 || remaining["remaining"] != 10 {
+        t.Errorf("got %v, want count 0 and 10 remaining", remaining)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    count, terminated := addViolation(testConfig, "alice", "TAB_CHANGE", "", "", 0, false)
+    if terminated || count != violationWeight(testConfig, "TAB_CHANGE") {
+        t.Errorf("first violation of the exam: count %d, terminated %v", count, terminated)
+    }
+    if examSessions["alice"].Terminated {
+        t.Error("session terminated by another exam's violations")
+    }
+    if total := violationCount("alice"); total != 12+count {
+        t.Errorf("overall total = %d, want %d", total, 12+count)
+    }
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+)
+
+const (
+    webhookBaseBackoff = time.Second
+    webhookMaxBackoff  = 5 * time.Minute
+
+    // webhookWorkers is how many deliveries may be in flight at once.
+    webhookWorkers = 4
+)
+
+type webhookDelivery struct {
+    URL      string
+    Secret   string
+    Payload  []byte
+    Attempts int
+}
+
+var webhookQueue = make(chan webhookDelivery, 1000)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// enqueueWebhook queues payload for delivery to url, signed with secret,
+// without blocking the caller.
+func enqueueWebhook(url, secret string, payload interface{}) {
+    body, err := json.Marshal(payload)
+    if err != nil {
+        log.Printf("webhook: encoding payload: %v", err)
+        return
+    }
+
+    select {
+    case webhookQueue <- webhookDelivery{URL: url, Secret: secret, Payload: body}:
+    default:
+        log.Printf("webhook: queue full, dropping delivery to %s", url)
+    }
+}
+
+// completionWebhookSecret returns the secret completion webhooks are signed
+// with: their own, or the violation webhooks' when they have none.
+func completionWebhookSecret(cfg *Config) string {
+    if cfg.CompletionWebhookSecret != "" {
+        return cfg.CompletionWebhookSecret
+    }
+    return cfg.WebhookSecret
+}
+
+// signPayload returns the hex HMAC-SHA256 of body under secret.
+func signPayload(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendWebhook(d webhookDelivery) error {
+    req, err := http.NewRequest("POST", d.URL, bytes.NewReader(d.Payload))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-Proctor-Signature", "sha256="+signPayload(d.Secret, d.Payload))
+
+    resp, err := webhookClient.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    return nil
+}
+
+// runWebhookWorker delivers queued webhooks, requeueing failures with
+// exponential backoff rather than waiting on them. webhookWorkers of these
+// share the queue, so a slow endpoint only ties up the worker sending to it
+// while the others keep delivering.
+func runWebhookWorker(cfg *Config) {
+    for d := range webhookQueue {
+        err := sendWebhook(d)
+        if err == nil {
+            continue
+        }
+
+        d.Attempts++
+        if d.Attempts >= cfg.WebhookMaxAttempts {
+            log.Printf("webhook: giving up on %s after %d attempts: %v", d.URL, d.Attempts, err)
+            continue
+        }
+
+        backoff := webhookBaseBackoff << uint(d.Attempts-1)
+        if backoff > webhookMaxBackoff {
+            backoff = webhookMaxBackoff
+        }
+        log.Printf("webhook: delivery to %s failed (attempt %d), retrying in %s: %v", d.URL, d.Attempts, backoff, err)
+
+        retry := d
+        time.AfterFunc(backoff, func() {
+            // Never block the timer on a full queue, or a dead endpoint
+            // would pile up stuck retries.
+            select {
+            case webhookQueue <- retry:
+            default:
+                log.Printf("webhook: queue full, dropping retry to %s", retry.URL)
+            }
+        })
+    }
+}